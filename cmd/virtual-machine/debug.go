@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+const debugHelp = `break <label|line>   set a breakpoint on a label or a source line (b)
+delete <label|line>  remove a breakpoint
+breakpoints          list all breakpoints
+step                 execute a single instruction (s)
+next                 like step, but runs a call until it returns (n)
+continue             run until a breakpoint is hit or the program ends (c)
+where                show the current instruction (w)
+stack                show the object stack
+storage              show all global values
+locals               show the locals of the current procedure
+refs                 show the pending calls
+set <name> <value>   store a value, e.g. set x 42 or set s "text"
+push <value>         push a value onto the object stack
+help                 show this help
+quit                 leave the debugger (q)`
+
+type debugger struct {
+	vm          *interpreter.Interpreter
+	input       *bufio.Reader // shared with the interpreter, see debug
+	output      io.Writer
+	breakpoints map[int]string // instruction index -> how the breakpoint was specified
+}
+
+// debug runs a program under an interactive debugger.
+func debug(args []string) {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %v debug file\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	instructions, labels, err := load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// the interpreter reads from the same reader, so input instructions
+	// consume the lines following the command running them
+	reader := bufio.NewReader(os.Stdin)
+	debugger := &debugger{
+		vm:          interpreter.NewInterpreter(instructions, labels, interpreter.WithMaxStackDepth(*maxStack), interpreter.WithStdin(reader)),
+		input:       reader,
+		output:      os.Stdout,
+		breakpoints: make(map[int]string),
+	}
+	debugger.run()
+}
+
+func (debugger *debugger) run() {
+	fmt.Fprintln(debugger.output, "sick debugger, type help for help")
+	debugger.where()
+	for {
+		fmt.Fprint(debugger.output, "(debug) ")
+		line, err := debugger.input.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(debugger.output)
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "break", "b":
+			debugger.setBreakpoint(fields[1:])
+		case "delete":
+			debugger.deleteBreakpoint(fields[1:])
+		case "breakpoints":
+			debugger.listBreakpoints()
+		case "step", "s":
+			debugger.resume(debugger.vm.Step())
+		case "next", "n":
+			debugger.next()
+		case "continue", "c":
+			debugger.resume(debugger.continueUntil(-1))
+		case "where", "w":
+			debugger.where()
+		case "stack":
+			printStack(debugger.output, debugger.vm)
+		case "storage":
+			printStorage(debugger.output, debugger.vm)
+		case "locals":
+			printValues(debugger.output, debugger.vm.Locals())
+		case "refs":
+			debugger.refs()
+		case "set":
+			debugger.set(fields[1:])
+		case "push":
+			value, err := parseDebugValue(strings.Join(fields[1:], " "))
+			if err != nil {
+				fmt.Fprintln(debugger.output, err)
+				continue
+			}
+			debugger.vm.Push(value)
+			printStack(debugger.output, debugger.vm)
+		case "help":
+			fmt.Fprintln(debugger.output, debugHelp)
+		case "quit", "q":
+			return
+		default:
+			fmt.Fprintf(debugger.output, "unknown command %v, type help for help\n", fields[0])
+		}
+	}
+}
+
+// continueUntil executes instructions until a breakpoint is hit, the program
+// ends or, if depth isn't negative, the reference stack shrinks to depth.
+func (debugger *debugger) continueUntil(depth int) error {
+	for first := true; !debugger.vm.Halted(); first = false {
+		if _, ok := debugger.breakpoints[debugger.vm.PC()]; ok && !first {
+			return nil
+		}
+
+		if err := debugger.vm.Step(); err != nil {
+			return err
+		}
+
+		if depth >= 0 && len(debugger.vm.ReferenceStack()) <= depth {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (debugger *debugger) next() {
+	if debugger.vm.Halted() || debugger.vm.Instructions[debugger.vm.PC()].OpCode != instructions.INS_CALL {
+		debugger.resume(debugger.vm.Step())
+		return
+	}
+
+	depth := len(debugger.vm.ReferenceStack())
+	if err := debugger.vm.Step(); err != nil {
+		debugger.resume(err)
+		return
+	}
+	debugger.resume(debugger.continueUntil(depth))
+}
+
+func (debugger *debugger) resume(err error) {
+	if err != nil {
+		fmt.Fprintln(debugger.output, err)
+	}
+
+	if label, ok := debugger.breakpoints[debugger.vm.PC()]; ok && !debugger.vm.Halted() {
+		fmt.Fprintf(debugger.output, "breakpoint %v\n", label)
+	}
+	debugger.where()
+}
+
+func (debugger *debugger) where() {
+	if debugger.vm.Halted() {
+		fmt.Fprintln(debugger.output, "program ended")
+		return
+	}
+
+	pc := debugger.vm.PC()
+	instruction := debugger.vm.Instructions[pc]
+
+	parts := []string{instructions.Mnemonic(instruction.OpCode)}
+	for _, param := range instruction.Params {
+		parts = append(parts, fmt.Sprint(param))
+	}
+
+	location := fmt.Sprintf("instruction %v", pc)
+	if instruction.Line > 0 {
+		location += fmt.Sprintf(", line %v", instruction.Line)
+	}
+	fmt.Fprintf(debugger.output, "%v: %v\n", location, strings.Join(parts, " "))
+}
+
+func (debugger *debugger) refs() {
+	references := debugger.vm.ReferenceStack()
+	if len(references) == 0 {
+		fmt.Fprintln(debugger.output, "no pending calls")
+		return
+	}
+
+	for i := len(references) - 1; i >= 0; i-- {
+		call := references[i] - 1
+		fmt.Fprintf(debugger.output, "called from instruction %v", call)
+		if line := debugger.vm.Instructions[call].Line; line > 0 {
+			fmt.Fprintf(debugger.output, " (line %v)", line)
+		}
+		fmt.Fprintln(debugger.output)
+	}
+}
+
+// resolveLocation finds the instruction a label or source line refers to.
+func (debugger *debugger) resolveLocation(args []string) (int, string, bool) {
+	if len(args) != 1 {
+		fmt.Fprintln(debugger.output, "a label or line is required")
+		return 0, "", false
+	}
+
+	location := args[0]
+	if line, err := strconv.Atoi(location); err == nil {
+		for i, instruction := range debugger.vm.Instructions {
+			if instruction.Line >= line {
+				return i, fmt.Sprintf("line %v", instruction.Line), true
+			}
+		}
+		fmt.Fprintf(debugger.output, "no instruction at or after line %v\n", line)
+		return 0, "", false
+	}
+
+	index, ok := (*debugger.vm.Labels)[location]
+	if !ok {
+		fmt.Fprintf(debugger.output, "undefined label %v\n", location)
+		return 0, "", false
+	}
+	return index, location, true
+}
+
+func (debugger *debugger) setBreakpoint(args []string) {
+	index, description, ok := debugger.resolveLocation(args)
+	if !ok {
+		return
+	}
+
+	debugger.breakpoints[index] = description
+	fmt.Fprintf(debugger.output, "breakpoint %v at instruction %v\n", description, index)
+}
+
+func (debugger *debugger) deleteBreakpoint(args []string) {
+	index, _, ok := debugger.resolveLocation(args)
+	if !ok {
+		return
+	}
+
+	delete(debugger.breakpoints, index)
+}
+
+func (debugger *debugger) listBreakpoints() {
+	indices := make([]int, 0, len(debugger.breakpoints))
+	for index := range debugger.breakpoints {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	for _, index := range indices {
+		fmt.Fprintf(debugger.output, "%v at instruction %v\n", debugger.breakpoints[index], index)
+	}
+}
+
+func (debugger *debugger) set(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(debugger.output, "usage: set <name> <value>")
+		return
+	}
+
+	value, err := parseDebugValue(strings.Join(args[1:], " "))
+	if err != nil {
+		fmt.Fprintln(debugger.output, err)
+		return
+	}
+	debugger.vm.Store(args[0], value)
+}
+
+// parseDebugValue reads a literal the way the push instructions do.
+func parseDebugValue(literal string) (types.SickObject, error) {
+	if len(literal) >= 2 && strings.HasPrefix(literal, "\"") && strings.HasSuffix(literal, "\"") {
+		return types.SickString{Value: literal[1 : len(literal)-1]}, nil
+	}
+	if value, err := strconv.Atoi(literal); err == nil {
+		return types.SickInt{Value: value}, nil
+	}
+	if value, err := strconv.ParseFloat(literal, 64); err == nil {
+		return types.SickFloat{Value: value}, nil
+	}
+	if value, err := strconv.ParseBool(literal); err == nil {
+		return types.SickBool{Value: value}, nil
+	}
+	return nil, fmt.Errorf("%v is not a valid value", literal)
+}
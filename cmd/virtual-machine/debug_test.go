@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+)
+
+const debugProgram = `ipush 1
+call double
+println
+jmp end
+double:
+arg 0
+ipush 2
+mul
+swap
+drop
+ret
+end:`
+
+// debugSession runs the debugger on source with the given input and returns
+// everything it printed after the banner.
+func debugSession(t *testing.T, source string, input string) string {
+	t.Helper()
+
+	instructions, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output strings.Builder
+	reader := bufio.NewReader(strings.NewReader(input))
+	debugger := &debugger{
+		vm:          interpreter.NewInterpreter(instructions, labels, interpreter.WithStdout(&output), interpreter.WithStdin(reader)),
+		input:       reader,
+		output:      &output,
+		breakpoints: make(map[int]string),
+	}
+	debugger.run()
+	return strings.TrimPrefix(output.String(), "sick debugger, type help for help\n")
+}
+
+func TestDebugger(t *testing.T) {
+	testCases := []struct {
+		name     string
+		commands string
+		expected string
+	}{
+		{
+			"step into a call",
+			"s\ns\ns\nrefs\n",
+			"instruction 0, line 1: ipush 1\n(debug) instruction 1, line 2: call double\n(debug) instruction 4, line 5: void double\n(debug) instruction 5, line 6: arg 0\n(debug) called from instruction 1 (line 2)\n(debug) \n",
+		},
+		{
+			"next runs a call until it returns",
+			"n\nn\nrefs\nstack\n",
+			"instruction 0, line 1: ipush 1\n(debug) instruction 1, line 2: call double\n(debug) instruction 2, line 3: println\n(debug) no pending calls\n(debug) stack: [2]\n(debug) \n",
+		},
+		{
+			"next stops at a breakpoint inside the call",
+			"b 8\nn\nn\nrefs\n",
+			"instruction 0, line 1: ipush 1\n(debug) breakpoint line 8 at instruction 7\n(debug) instruction 1, line 2: call double\n(debug) breakpoint line 8\ninstruction 7, line 8: mul\n(debug) called from instruction 1 (line 2)\n(debug) \n",
+		},
+		{
+			"continue from breakpoint to breakpoint",
+			"b double\nb 8\nc\nc\nstack\nc\nc\n",
+			"instruction 0, line 1: ipush 1\n(debug) breakpoint double at instruction 4\n(debug) breakpoint line 8 at instruction 7\n(debug) breakpoint double\ninstruction 4, line 5: void double\n(debug) breakpoint line 8\ninstruction 7, line 8: mul\n(debug) stack: [1, 1, 2]\n(debug) 2\nprogram ended\n(debug) program ended\n(debug) \n",
+		},
+		{
+			"breakpoint locations",
+			"b 20\nb nope\nb\nb 5\nb 3\nbreakpoints\ndelete double\nbreakpoints\n",
+			"instruction 0, line 1: ipush 1\n(debug) no instruction at or after line 20\n(debug) undefined label nope\n(debug) a label or line is required\n(debug) breakpoint line 5 at instruction 4\n(debug) breakpoint line 3 at instruction 2\n(debug) line 3 at instruction 2\nline 5 at instruction 4\n(debug) (debug) line 3 at instruction 2\n(debug) \n",
+		},
+		{
+			"change the state",
+			"set x 4\nset s \"a b\"\nset x\nstorage\npush 1.5\npush nope\n",
+			"instruction 0, line 1: ipush 1\n(debug) (debug) (debug) usage: set <name> <value>\n(debug) s = \"a b\"\nx = 4\n(debug) stack: [1.5]\n(debug) nope is not a valid value\n(debug) \n",
+		},
+		{
+			"errors stop continue at the failing instruction",
+			"b 8\nc\npush true\nc\nwhere\n",
+			"instruction 0, line 1: ipush 1\n(debug) breakpoint line 8 at instruction 7\n(debug) breakpoint line 8\ninstruction 7, line 8: mul\n(debug) stack: [1, 1, 2, true]\n(debug) runtime error at instruction 7 (mul, line 8): can't do sick::int * sick::bool\n\tcalled from instruction 1 (line 2)\nbreakpoint line 8\ninstruction 7, line 8: mul\n(debug) instruction 7, line 8: mul\n(debug) \n",
+		},
+		{
+			"unknown command and quit",
+			"bogus\nq\nc\n",
+			"instruction 0, line 1: ipush 1\n(debug) unknown command bogus, type help for help\n(debug) ",
+		},
+	}
+
+	for _, testCase := range testCases {
+		if output := debugSession(t, debugProgram, testCase.commands); output != testCase.expected {
+			t.Errorf("%v: expected\n%v\ngot\n%v", testCase.name, testCase.expected, output)
+		}
+	}
+}
+
+func TestDebuggerInput(t *testing.T) {
+	output := debugSession(t, "readln\nprintln", "c\nhello\nwhere\n")
+	expected := "instruction 0, line 1: readln\n(debug) hello\nprogram ended\n(debug) program ended\n(debug) \n"
+	if output != expected {
+		t.Errorf("expected readln to read the line after the command, expected\n%v\ngot\n%v", expected, output)
+	}
+}
@@ -1,28 +1,69 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"mvmo.dev/sickvm/internal/pkg/bytecode"
+	"mvmo.dev/sickvm/internal/pkg/disassembler"
+	"mvmo.dev/sickvm/internal/pkg/instructions"
 	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/optimizer"
 	"mvmo.dev/sickvm/internal/pkg/parser"
+	"mvmo.dev/sickvm/internal/pkg/register"
+	"mvmo.dev/sickvm/internal/pkg/verify"
 )
 
 var (
 	inputFile *string
 	timing    *bool
+	maxStack  *int
+	gasLimit  *int
+	timeout   *time.Duration
+	optimize  *bool
+	backend   *string
 )
 
 func init() {
 	inputFile = flag.String("file", "undefined", "file to be interpreted")
 	timing = flag.Bool("timing", false, "enable timing for compiler")
+	maxStack = flag.Int("max-stack", 0, "maximum depth of the object stack, 0 for no limit")
+	gasLimit = flag.Int("gas", 0, "maximum amount of instructions to execute, 0 for no limit")
+	timeout = flag.Duration("timeout", 0, "abort the program after this duration, e.g. 1s, 0 for no timeout")
+	optimize = flag.Bool("O", false, "optimize the program before running it")
+	backend = flag.String("backend", "stack", "how the program is executed, stack or register, which falls back to stack for programs it can't translate")
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "build":
+			build(os.Args[2:])
+			return
+		case "check":
+			check(os.Args[2:])
+			return
+		case "disasm":
+			disasm(os.Args[2:])
+			return
+		case "debug":
+			debug(os.Args[2:])
+			return
+		case "repl":
+			flag.CommandLine.Parse(os.Args[2:])
+			repl(os.Stdin, os.Stdout)
+			return
+		}
+	}
+
 	flag.Parse()
 
 	if strings.ToLower(*inputFile) == "undefined" {
@@ -32,27 +73,186 @@ func main() {
 
 	startTime := time.Now()
 
-	content, err := ioutil.ReadFile(*inputFile)
+	instructions, labels, err := load(*inputFile)
 	if err != nil {
-		log.Fatalf("unable to read file: %v\n", err)
-		return
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *optimize {
+		instructions, labels = optimizer.Optimize(instructions, labels)
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	switch *backend {
+	case "stack":
+	case "register":
+		if *maxStack > 0 || *gasLimit > 0 {
+			log.Fatalf("the register backend doesn't support -max-stack and -gas")
+		}
+
+		// Translate only accepts programs with the same stack depth on every
+		// path to an instruction, everything else runs on the stack interpreter.
+		program, err := register.Translate(instructions, labels)
+		if err == nil {
+			if err := register.NewMachine(program).RunContext(ctx); err != nil {
+				log.Print(err)
+			}
+
+			if *timing {
+				log.Printf("took: %v", time.Since(startTime))
+			}
+			return
+		}
+		log.Printf("the register backend can't run this program, using the stack interpreter: %v", err)
+	default:
+		log.Fatalf("unknown backend %v, use stack or register", *backend)
+	}
+
+	interpreter := interpreter.NewInterpreter(instructions, labels, interpreter.WithMaxStackDepth(*maxStack), interpreter.WithGasLimit(*gasLimit))
+	if err := interpreter.RunContext(ctx); err != nil {
+		log.Print(err)
 	}
 
-	parser := parser.NewParser()
-	instructions, labels, err := parser.Parse(string(content))
+	if *timing {
+		log.Printf("took: %v, gas used: %v", time.Since(startTime), interpreter.GasUsed())
+	}
+}
+
+// load reads a program from either a .sickc source or a bytecode file.
+func load(file string) ([]instructions.Instruction, *map[string]int, error) {
+	content, err := ioutil.ReadFile(file)
 	if err != nil {
-		fmt.Println(err)
+		return nil, nil, fmt.Errorf("unable to read file: %v", err)
+	}
+
+	if bytecode.IsBytecode(content) {
+		return bytecode.Decode(bytes.NewReader(content))
+	}
+
+	return parser.NewParser().ParseFile(file, string(content))
+}
+
+// build assembles a .sickc source into a bytecode file.
+func build(args []string) {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "output file, defaults to the input file with a .sickb extension")
+	optimize := flags.Bool("O", false, "optimize the program before writing it")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %v build [-O] [-o output] file.sickc\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
 	}
+	flags.Parse(args)
 
-	interpreter := interpreter.NewInterpreter(instructions, labels)
-	err = interpreter.Run()
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	input := flags.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(input, filepath.Ext(input)) + ".sickb"
+	}
+
+	instructions, labels, err := load(input)
 	if err != nil {
-		log.Print(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	elapsed := time.Since(startTime)
+	if *optimize {
+		instructions, labels = optimizer.Optimize(instructions, labels)
+	}
 
-	if *timing {
-		log.Printf("took: %v", elapsed)
+	file, err := os.Create(*output)
+	if err != nil {
+		log.Fatalf("unable to create file: %v\n", err)
+	}
+	defer file.Close()
+
+	if err := bytecode.Encode(file, instructions, labels); err != nil {
+		log.Fatalf("unable to write bytecode: %v\n", err)
+	}
+}
+
+// disasm prints a program as .sickc source.
+func disasm(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	indices := flags.Bool("indices", false, "print the index of every instruction")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %v disasm [-indices] file\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	instructions, labels, err := load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var options []disassembler.Option
+	if *indices {
+		options = append(options, disassembler.WithIndices())
+	}
+
+	if err := disassembler.Disassemble(os.Stdout, instructions, labels, options...); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// check verifies a program without running it and exits with 1 if it has errors.
+func check(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	natives := flags.String("natives", "", "comma separated names of the host functions the program is run with")
+	checkTypes := flags.Bool("types", false, "check the types of the operands of every instruction")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %v check [-types] [-natives name,...] file\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	file := flags.Arg(0)
+	instructions, labels, err := load(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var options []verify.Option
+	if *natives != "" {
+		options = append(options, verify.WithNatives(strings.Split(*natives, ",")...))
+	}
+	if *checkTypes {
+		options = append(options, verify.WithTypes())
+	}
+
+	diagnostics := verify.Verify(instructions, labels, options...)
+	for _, diagnostic := range diagnostics {
+		location := fmt.Sprintf("instruction %v", diagnostic.Instruction)
+		if diagnostic.Line > 0 {
+			location = fmt.Sprint(diagnostic.Line)
+		}
+		fmt.Fprintf(os.Stderr, "%v:%v: %v: %v\n", file, location, diagnostic.Severity, diagnostic.Message)
+	}
+
+	if verify.HasErrors(diagnostics) {
+		os.Exit(1)
 	}
 }
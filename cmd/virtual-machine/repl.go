@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+const replHelp = `every line is parsed and executed right away, the stack is shown afterwards
+:dump         show the stack and all stored values
+:reset        start over with an empty stack and storage
+:load <file>  run a file against the current state, its labels stay callable
+:labels       list all known labels
+:help         show this help
+:quit         leave the repl`
+
+// repl reads instructions line by line and runs them against a persistent interpreter.
+func repl(input io.Reader, output io.Writer) {
+	// the interpreter reads from the same reader, so input instructions
+	// consume the lines following them
+	reader := bufio.NewReader(input)
+	vm := newReplInterpreter(reader, output)
+
+	fmt.Fprintln(output, "sick repl, type :help for help")
+	for {
+		fmt.Fprint(output, "> ")
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(output)
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			fields := strings.Fields(line)
+			switch fields[0] {
+			case ":dump":
+				printStack(output, vm)
+				printStorage(output, vm)
+			case ":reset":
+				vm = newReplInterpreter(reader, output)
+			case ":load":
+				if len(fields) != 2 {
+					fmt.Fprintln(output, "usage: :load <file>")
+					continue
+				}
+				instructions, labels, err := load(fields[1])
+				if err != nil {
+					fmt.Fprintln(output, err)
+					continue
+				}
+				vm.Append(instructions, labels)
+				runRepl(output, vm)
+			case ":labels":
+				printLabels(output, vm)
+			case ":help":
+				fmt.Fprintln(output, replHelp)
+			case ":quit", ":q":
+				return
+			default:
+				fmt.Fprintf(output, "unknown command %v, type :help for help\n", fields[0])
+			}
+			continue
+		}
+
+		instructions, labels, err := parser.NewParser().ParseFile("<repl>", line)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			continue
+		}
+
+		vm.Append(instructions, labels)
+		runRepl(output, vm)
+	}
+}
+
+func newReplInterpreter(input io.Reader, output io.Writer) *interpreter.Interpreter {
+	return interpreter.NewInterpreter(nil, nil, interpreter.WithMaxStackDepth(*maxStack), interpreter.WithStdout(output), interpreter.WithStderr(output), interpreter.WithStdin(input))
+}
+
+func runRepl(output io.Writer, vm *interpreter.Interpreter) {
+	if err := vm.Run(); err != nil {
+		fmt.Fprintln(output, err)
+		// skip whatever is left of the failed input, including the calls
+		// and handlers it left pending
+		vm.Unwind()
+		vm.Append(nil, nil)
+	}
+	printStack(output, vm)
+}
+
+func printStack(output io.Writer, vm *interpreter.Interpreter) {
+	fmt.Fprintf(output, "stack: %v\n", types.NewSickArray(vm.Stack()...).ToHuman())
+}
+
+func printStorage(output io.Writer, vm *interpreter.Interpreter) {
+	printValues(output, vm.Storage())
+}
+
+func printValues(output io.Writer, storage map[string]types.SickObject) {
+	identifiers := make([]string, 0, len(storage))
+	for identifier := range storage {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+
+	for _, identifier := range identifiers {
+		fmt.Fprintf(output, "%v = %v\n", identifier, types.Format(storage[identifier]))
+	}
+}
+
+func printLabels(output io.Writer, vm *interpreter.Interpreter) {
+	names := make([]string, 0, len(*vm.Labels))
+	for name := range *vm.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(output, "%v: %v\n", name, (*vm.Labels)[name])
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// session runs the repl on input and returns everything it printed after the banner.
+func session(t *testing.T, input string) string {
+	t.Helper()
+
+	var output strings.Builder
+	repl(strings.NewReader(input), &output)
+	return strings.TrimPrefix(output.String(), "sick repl, type :help for help\n")
+}
+
+func TestRepl(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fail.sickc")
+	if err := ioutil.WriteFile(file, []byte("jmp end\nfail:\nipush 1\nipush 0\ndiv\nret\nend:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"stack persists", "ipush 1\nipush 2\nadd\n", []string{"> stack: [1]\n", "> stack: [1, 2]\n", "> stack: [3]\n"}},
+		{"storage", "ipush 1\nstore x\n:dump\n", []string{"> stack: []\nx = 1\n"}},
+		{"parse error", "ipush\nipush 1\n", []string{"<repl>:1:", "> stack: [1]\n"}},
+		{"input", "readln\nhello\n", []string{`> stack: ["hello"]`}},
+		{"runtime error", "ipush 1\nipush 0\ndiv\nipush 2\n", []string{"division by zero\nstack: [1, 0]\n", "> stack: [1, 0, 2]\n"}},
+		{"reset", "ipush 1\n:reset\n:dump\n", []string{"> > stack: []\n"}},
+		{"load", ":load " + file + "\n:labels\ncall fail\n", []string{"end: 6\nfail: 1\n", "division by zero\n\tcalled from instruction 7 (line 1)\n"}},
+		// the failed call must not stay pending, otherwise arg would read its arguments
+		{"error drops calls", ":load " + file + "\ncall fail\narg 0\n", []string{"arg outside of a procedure"}},
+		{"unknown command", ":bogus\n", []string{"unknown command :bogus"}},
+	}
+
+	for _, testCase := range testCases {
+		output := session(t, testCase.input)
+		for _, expected := range testCase.expected {
+			if !strings.Contains(output, expected) {
+				t.Errorf("%v: expected the output to contain %q, got\n%v", testCase.name, expected, output)
+			}
+		}
+	}
+
+	if output := session(t, ":quit\nipush 1\n"); output != "> " {
+		t.Errorf("expected the repl to stop at :quit, got\n%v", output)
+	}
+}
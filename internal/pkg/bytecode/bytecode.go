@@ -0,0 +1,311 @@
+// Package bytecode implements the binary format sick programs are shipped in.
+//
+// A file starts with the magic bytes and the format version, followed by the
+// constant pool, the label table and the instruction stream. Every number is
+// stored as a (u)varint and strings are referenced by their index in the
+// constant pool:
+//
+//	magic        "SICK"
+//	version      uvarint
+//	constants    uvarint count, then count times: uvarint length, bytes
+//	labels       uvarint count, then count times: uvarint name, uvarint instruction
+//	instructions uvarint count, then count times: uvarint opcode, uvarint param count, params
+//
+// Every param is a one byte tag followed by its value, floats are stored as
+// 8 byte little endian IEEE 754 numbers.
+package bytecode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+)
+
+const Version = 1
+
+var Magic = []byte("SICK")
+
+var ErrInvalidFormat = errors.New("bytecode: invalid format")
+
+const (
+	tagInt = iota
+	tagString
+	tagBool
+	tagFloat
+)
+
+// IsBytecode reports whether data starts with the bytecode magic header.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, Magic)
+}
+
+type encoder struct {
+	writer    *bufio.Writer
+	constants []string
+	pool      map[string]int
+	buffer    [binary.MaxVarintLen64]byte
+}
+
+func (encoder *encoder) constant(str string) int {
+	if index, ok := encoder.pool[str]; ok {
+		return index
+	}
+
+	index := len(encoder.constants)
+	encoder.constants = append(encoder.constants, str)
+	encoder.pool[str] = index
+	return index
+}
+
+func (encoder *encoder) uvarint(value int) {
+	n := binary.PutUvarint(encoder.buffer[:], uint64(value))
+	encoder.writer.Write(encoder.buffer[:n])
+}
+
+func (encoder *encoder) varint(value int) {
+	n := binary.PutVarint(encoder.buffer[:], int64(value))
+	encoder.writer.Write(encoder.buffer[:n])
+}
+
+// Encode writes instructions and labels to w in the bytecode format.
+func Encode(w io.Writer, instructionList []instructions.Instruction, labels *map[string]int) error {
+	encoder := &encoder{writer: bufio.NewWriter(w), pool: make(map[string]int)}
+
+	var labelNames []string
+	if labels != nil {
+		for name := range *labels {
+			labelNames = append(labelNames, name)
+		}
+	}
+	sort.Strings(labelNames)
+
+	// every string needs to be in the pool before the pool is written,
+	// so the params are validated and collected up front
+	for i, instruction := range instructionList {
+		for _, param := range instruction.Params {
+			switch param := param.(type) {
+			case string:
+				encoder.constant(param)
+			case int, bool, float64:
+			default:
+				return fmt.Errorf("bytecode: can't encode param %v of instruction %v", param, i)
+			}
+		}
+	}
+	for _, name := range labelNames {
+		encoder.constant(name)
+	}
+
+	encoder.writer.Write(Magic)
+	encoder.uvarint(Version)
+
+	encoder.uvarint(len(encoder.constants))
+	for _, constant := range encoder.constants {
+		encoder.uvarint(len(constant))
+		encoder.writer.WriteString(constant)
+	}
+
+	encoder.uvarint(len(labelNames))
+	for _, name := range labelNames {
+		encoder.uvarint(encoder.pool[name])
+		encoder.uvarint((*labels)[name])
+	}
+
+	encoder.uvarint(len(instructionList))
+	for _, instruction := range instructionList {
+		encoder.uvarint(instruction.OpCode)
+		encoder.uvarint(len(instruction.Params))
+		for _, param := range instruction.Params {
+			switch param := param.(type) {
+			case int:
+				encoder.writer.WriteByte(tagInt)
+				encoder.varint(param)
+			case string:
+				encoder.writer.WriteByte(tagString)
+				encoder.uvarint(encoder.pool[param])
+			case bool:
+				encoder.writer.WriteByte(tagBool)
+				if param {
+					encoder.writer.WriteByte(1)
+				} else {
+					encoder.writer.WriteByte(0)
+				}
+			case float64:
+				encoder.writer.WriteByte(tagFloat)
+				binary.Write(encoder.writer, binary.LittleEndian, math.Float64bits(param))
+			}
+		}
+	}
+
+	return encoder.writer.Flush()
+}
+
+type decoder struct {
+	reader    *bufio.Reader
+	constants []string
+	err       error
+}
+
+// fail records the first error, reading continues with zero values so the
+// caller only has to check once at the end.
+func (decoder *decoder) fail(format string, args ...interface{}) {
+	if decoder.err == nil {
+		decoder.err = fmt.Errorf("%w: %v", ErrInvalidFormat, fmt.Sprintf(format, args...))
+	}
+}
+
+func (decoder *decoder) uvarint() int {
+	if decoder.err != nil {
+		return 0
+	}
+
+	value, err := binary.ReadUvarint(decoder.reader)
+	if err != nil || value > uint64(^uint(0)>>1) {
+		decoder.fail("malformed unsigned number")
+		return 0
+	}
+	return int(value)
+}
+
+func (decoder *decoder) varint() int {
+	if decoder.err != nil {
+		return 0
+	}
+
+	value, err := binary.ReadVarint(decoder.reader)
+	if err != nil {
+		decoder.fail("malformed number")
+		return 0
+	}
+	return int(value)
+}
+
+func (decoder *decoder) byte() byte {
+	if decoder.err != nil {
+		return 0
+	}
+
+	value, err := decoder.reader.ReadByte()
+	if err != nil {
+		decoder.fail("unexpected end of input")
+		return 0
+	}
+	return value
+}
+
+func (decoder *decoder) float() float64 {
+	if decoder.err != nil {
+		return 0
+	}
+
+	var bits uint64
+	if err := binary.Read(decoder.reader, binary.LittleEndian, &bits); err != nil {
+		decoder.fail("unexpected end of input")
+		return 0
+	}
+	return math.Float64frombits(bits)
+}
+
+func (decoder *decoder) string() string {
+	length := decoder.uvarint()
+	if decoder.err != nil {
+		return ""
+	}
+
+	// copying instead of allocating length bytes up front keeps a corrupt
+	// length from allocating more memory than the input actually has
+	var buffer bytes.Buffer
+	if _, err := io.CopyN(&buffer, decoder.reader, int64(length)); err != nil {
+		decoder.fail("unexpected end of input")
+		return ""
+	}
+	return buffer.String()
+}
+
+func (decoder *decoder) constant() string {
+	index := decoder.uvarint()
+	if decoder.err != nil {
+		return ""
+	}
+
+	if index >= len(decoder.constants) {
+		decoder.fail("constant %v out of range", index)
+		return ""
+	}
+	return decoder.constants[index]
+}
+
+// Decode reads a program in the bytecode format from r.
+func Decode(r io.Reader) ([]instructions.Instruction, *map[string]int, error) {
+	decoder := &decoder{reader: bufio.NewReader(r)}
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(decoder.reader, magic); err != nil || !bytes.Equal(magic, Magic) {
+		return nil, nil, fmt.Errorf("%w: missing magic header", ErrInvalidFormat)
+	}
+
+	if version := decoder.uvarint(); decoder.err == nil && version != Version {
+		return nil, nil, fmt.Errorf("bytecode: unsupported version %v", version)
+	}
+
+	constantCount := decoder.uvarint()
+	for i := 0; i < constantCount && decoder.err == nil; i++ {
+		decoder.constants = append(decoder.constants, decoder.string())
+	}
+
+	labels := make(map[string]int)
+	labelCount := decoder.uvarint()
+	for i := 0; i < labelCount && decoder.err == nil; i++ {
+		name := decoder.constant()
+		labels[name] = decoder.uvarint()
+	}
+
+	var instructionList []instructions.Instruction
+	instructionCount := decoder.uvarint()
+	for i := 0; i < instructionCount && decoder.err == nil; i++ {
+		instruction := instructions.Instruction{OpCode: decoder.uvarint()}
+
+		paramCount := decoder.uvarint()
+		for j := 0; j < paramCount && decoder.err == nil; j++ {
+			switch tag := decoder.byte(); tag {
+			case tagInt:
+				instruction.Params = append(instruction.Params, decoder.varint())
+			case tagString:
+				instruction.Params = append(instruction.Params, decoder.constant())
+			case tagBool:
+				instruction.Params = append(instruction.Params, decoder.byte() != 0)
+			case tagFloat:
+				instruction.Params = append(instruction.Params, decoder.float())
+			default:
+				decoder.fail("unknown param tag %v", tag)
+			}
+		}
+
+		if decoder.err == nil {
+			if err := instructions.Validate(instruction); err != nil {
+				decoder.fail("instruction %v: %v", i, err)
+			}
+		}
+
+		instructionList = append(instructionList, instruction)
+	}
+
+	if decoder.err != nil {
+		return nil, nil, decoder.err
+	}
+
+	for name, index := range labels {
+		if index < 0 || index > len(instructionList) {
+			return nil, nil, fmt.Errorf("%w: label %v points to missing instruction %v", ErrInvalidFormat, name, index)
+		}
+	}
+
+	return instructionList, &labels, nil
+}
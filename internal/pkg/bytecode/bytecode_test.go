@@ -0,0 +1,115 @@
+package bytecode_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/bytecode"
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+)
+
+const source = `start:
+spush "Hello, World!"
+println
+ipush -42
+fpush -0.125
+bpush true
+cjmp start end
+spush "Hello, World!"
+call start
+end:
+`
+
+func TestRoundTrip(t *testing.T) {
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := bytecode.Encode(&buffer, instructionList, labels); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytecode.IsBytecode(buffer.Bytes()) {
+		t.Fatalf("encoded program is missing the magic header")
+	}
+
+	decoded, decodedLabels, err := bytecode.Decode(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(*labels, *decodedLabels) {
+		t.Errorf("expected labels %v and got %v", *labels, *decodedLabels)
+	}
+
+	if len(decoded) != len(instructionList) {
+		t.Fatalf("expected %v instructions and got %v", len(instructionList), len(decoded))
+	}
+
+	for i, instruction := range instructionList {
+		if decoded[i].OpCode != instruction.OpCode || len(decoded[i].Params) != len(instruction.Params) {
+			t.Errorf("instruction %v: expected %v and got %v", i, instruction, decoded[i])
+			continue
+		}
+
+		for j, param := range instruction.Params {
+			if decoded[i].Params[j] != param {
+				t.Errorf("instruction %v: expected param %v and got %v", i, param, decoded[i].Params[j])
+			}
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := bytecode.Encode(&buffer, instructionList, labels); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buffer.Bytes()
+
+	inputs := [][]byte{
+		[]byte("ipush 1"),
+		encoded[:len(encoded)-1],
+		encoded[:len(bytecode.Magic)+3],
+	}
+
+	for _, input := range inputs {
+		if _, _, err := bytecode.Decode(bytes.NewReader(input)); !errors.Is(err, bytecode.ErrInvalidFormat) {
+			t.Errorf("expected ErrInvalidFormat for %q and got %v", input, err)
+		}
+	}
+}
+
+func TestDecodeRejectsMalformedInstructions(t *testing.T) {
+	programs := [][]instructions.Instruction{
+		{{OpCode: instructions.INS_JMP, Params: []interface{}{"end"}}},
+		{{OpCode: instructions.INS_JMP, Params: []interface{}{-1}}},
+		{{OpCode: instructions.INS_CJMP, Params: []interface{}{0}}},
+		{{OpCode: instructions.INS_LOAD, Params: []interface{}{1}}},
+		{{OpCode: instructions.INS_IPUSH}},
+		{{OpCode: instructions.INS_FPUSH, Params: []interface{}{true}}},
+		{{OpCode: instructions.INS_ADD, Params: []interface{}{1}}},
+		{{OpCode: 1000}},
+	}
+
+	for _, program := range programs {
+		var buffer bytes.Buffer
+		if err := bytecode.Encode(&buffer, program, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := bytecode.Decode(&buffer); !errors.Is(err, bytecode.ErrInvalidFormat) {
+			t.Errorf("expected ErrInvalidFormat for %v and got %v", program, err)
+		}
+	}
+}
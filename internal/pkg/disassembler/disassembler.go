@@ -0,0 +1,194 @@
+// Package disassembler turns instructions back into .sickc source.
+package disassembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+)
+
+type disassembler struct {
+	indices bool
+}
+
+// Option configures the output of Disassemble.
+type Option func(*disassembler)
+
+// WithIndices appends the index of every instruction as a comment.
+func WithIndices() Option {
+	return func(disassembler *disassembler) {
+		disassembler.indices = true
+	}
+}
+
+// Disassemble writes instructionList as .sickc source to w. Label definitions
+// are restored from labels and jump targets that point to a label use its name,
+// so parsing the output results in the same instructions and labels.
+func Disassemble(w io.Writer, instructionList []instructions.Instruction, labels *map[string]int, options ...Option) error {
+	disassembler := new(disassembler)
+	for _, option := range options {
+		option(disassembler)
+	}
+
+	labelsAt := make(map[int][]string)
+	if labels != nil {
+		for name, index := range *labels {
+			labelsAt[index] = append(labelsAt[index], name)
+		}
+	}
+	for _, names := range labelsAt {
+		sort.Strings(names)
+	}
+
+	// Every label definition is parsed into a void placeholder. As long as
+	// each label has its own placeholder the output parses into exactly the
+	// same instructions. Otherwise the additional definitions shift the
+	// following instructions, so every jump target gets a name to stay valid.
+	if !hasPlaceholders(instructionList, labelsAt) {
+		nameTargets(instructionList, labels, labelsAt)
+	}
+
+	writer := bufio.NewWriter(w)
+	width := len(strconv.Itoa(len(instructionList)))
+
+	for i, instruction := range instructionList {
+		line, err := disassembler.format(instruction, labelsAt)
+		if err != nil {
+			return fmt.Errorf("disassembler: instruction %v: %w", i, err)
+		}
+
+		names := labelsAt[i]
+		if name, ok := placeholderName(instruction); ok {
+			line = name + ":"
+			names = without(names, name)
+		} else if isPlaceholder(instruction) && len(names) > 0 {
+			line = names[len(names)-1] + ":"
+			names = names[:len(names)-1]
+		}
+
+		for _, name := range names {
+			fmt.Fprintln(writer, name+":")
+		}
+
+		if disassembler.indices {
+			fmt.Fprintf(writer, "%-32v ; %*v\n", line, width, i)
+		} else {
+			fmt.Fprintln(writer, line)
+		}
+	}
+
+	// labels can point behind the last instruction
+	for _, name := range labelsAt[len(instructionList)] {
+		fmt.Fprintln(writer, name+":")
+	}
+
+	return writer.Flush()
+}
+
+func hasLabel(labels map[string]int, name string) bool {
+	_, ok := labels[name]
+	return ok
+}
+
+// isPlaceholder reports whether instruction is the void a label definition is
+// parsed into. The parser stores the name of the label as its only param.
+func isPlaceholder(instruction instructions.Instruction) bool {
+	return instruction.OpCode == instructions.INS_VOID && len(instruction.Params) <= 1
+}
+
+func placeholderName(instruction instructions.Instruction) (string, bool) {
+	if instruction.OpCode != instructions.INS_VOID || len(instruction.Params) != 1 {
+		return "", false
+	}
+
+	name, ok := instruction.Params[0].(string)
+	return name, ok
+}
+
+func without(names []string, name string) []string {
+	var result []string
+	for _, other := range names {
+		if other != name {
+			result = append(result, other)
+		}
+	}
+	return result
+}
+
+func hasPlaceholders(instructionList []instructions.Instruction, labelsAt map[int][]string) bool {
+	for index, names := range labelsAt {
+		if index == len(instructionList) && len(names) == 1 {
+			continue
+		}
+
+		if len(names) > 1 || index < 0 || index > len(instructionList) || !isPlaceholder(instructionList[index]) {
+			return false
+		}
+
+		if name, ok := placeholderName(instructionList[index]); ok && name != names[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nameTargets adds a label to labelsAt for every jump target that has none.
+func nameTargets(instructionList []instructions.Instruction, labels *map[string]int, labelsAt map[int][]string) {
+	for _, instruction := range instructionList {
+		if !instructions.IsJump(instruction.OpCode) {
+			continue
+		}
+
+		for _, param := range instruction.Params {
+			target, ok := param.(int)
+			if !ok || len(labelsAt[target]) > 0 {
+				continue
+			}
+
+			name := fmt.Sprintf("L%v", target)
+			for labels != nil && hasLabel(*labels, name) {
+				name = "_" + name
+			}
+			labelsAt[target] = []string{name}
+		}
+	}
+}
+
+func (disassembler *disassembler) format(instruction instructions.Instruction, labelsAt map[int][]string) (string, error) {
+	parts := []string{instructions.Mnemonic(instruction.OpCode)}
+
+	for _, param := range instruction.Params {
+		switch param := param.(type) {
+		case int:
+			if instructions.IsJump(instruction.OpCode) && len(labelsAt[param]) > 0 {
+				parts = append(parts, labelsAt[param][0])
+				continue
+			}
+			parts = append(parts, strconv.Itoa(param))
+		case bool:
+			parts = append(parts, strconv.FormatBool(param))
+		case float64:
+			parts = append(parts, strconv.FormatFloat(param, 'g', -1, 64))
+		case string:
+			if instruction.OpCode != instructions.INS_SPUSH && instruction.OpCode != instructions.INS_NATIVE {
+				parts = append(parts, param)
+				continue
+			}
+
+			if strings.ContainsAny(param, "\"\n") {
+				return "", fmt.Errorf("string %q can't be represented in source", param)
+			}
+			parts = append(parts, "\""+param+"\"")
+		default:
+			return "", fmt.Errorf("unsupported param %v", param)
+		}
+	}
+
+	return strings.Join(parts, " "), nil
+}
@@ -0,0 +1,126 @@
+package disassembler_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/disassembler"
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+)
+
+// randomProgram generates a syntactically valid program, it doesn't have to be runnable.
+func randomProgram(random *rand.Rand) string {
+	labelNames := []string{"start", "loop", "end", "proc"}
+	words := []string{"Hello,", "World!", "sick", "", "  "}
+
+	var lines []string
+	for _, name := range labelNames {
+		lines = append(lines, name+":")
+	}
+	for i := random.Intn(40); i > 0; i-- {
+		switch random.Intn(8) {
+		case 0:
+			lines = append(lines, fmt.Sprintf("ipush %v", random.Intn(2000)-1000))
+		case 1:
+			lines = append(lines, fmt.Sprintf("spush \"%v %v\"", words[random.Intn(len(words))], words[random.Intn(len(words))]))
+		case 2:
+			lines = append(lines, fmt.Sprintf("bpush %v", random.Intn(2) == 0))
+		case 3:
+			lines = append(lines, fmt.Sprintf("jmp %v", labelNames[random.Intn(len(labelNames))]))
+		case 4:
+			lines = append(lines, fmt.Sprintf("cjmp %v %v", random.Intn(len(lines)+1), labelNames[random.Intn(len(labelNames))]))
+		case 5:
+			lines = append(lines, fmt.Sprintf("store var%v", random.Intn(3)))
+		case 6:
+			lines = append(lines, []string{"void", fmt.Sprintf("fpush %v", random.NormFloat64())}[random.Intn(2)])
+		default:
+			lines = append(lines, []string{"add", "sub", "dup", "swap", "drop", "println", "dump"}[random.Intn(7)])
+		}
+	}
+
+	random.Shuffle(len(lines), func(i, j int) { lines[i], lines[j] = lines[j], lines[i] })
+	return strings.Join(lines, "\n")
+}
+
+func withoutLines(instructionList []instructions.Instruction) []instructions.Instruction {
+	result := make([]instructions.Instruction, len(instructionList))
+	for i, instruction := range instructionList {
+		result[i] = instructions.Instruction{OpCode: instruction.OpCode, Params: instruction.Params}
+	}
+	return result
+}
+
+func assertRoundTrip(t *testing.T, source string, options ...disassembler.Option) {
+	t.Helper()
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatalf("%v\n%v", err, source)
+	}
+
+	var buffer bytes.Buffer
+	if err := disassembler.Disassemble(&buffer, instructionList, labels, options...); err != nil {
+		t.Fatal(err)
+	}
+
+	reparsed, reparsedLabels, err := parser.NewParser().Parse(buffer.String())
+	if err != nil {
+		t.Fatalf("%v\n%v", err, buffer.String())
+	}
+
+	if !reflect.DeepEqual(withoutLines(instructionList), withoutLines(reparsed)) || !reflect.DeepEqual(*labels, *reparsedLabels) {
+		t.Errorf("round trip changed the program:\n%v\n---\n%v", source, buffer.String())
+	}
+}
+
+func TestRoundTripExamples(t *testing.T) {
+	files, err := filepath.Glob("../../../examples/*.sickc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertRoundTrip(t, string(content))
+		assertRoundTrip(t, string(content), disassembler.WithIndices())
+	}
+}
+
+func TestRoundTripDuplicateLabels(t *testing.T) {
+	assertRoundTrip(t, "a:\nipush 1\na:\nprintln\njmp a")
+}
+
+func TestRoundTripProperty(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		assertRoundTrip(t, randomProgram(random), disassembler.WithIndices())
+	}
+}
+
+func TestDisassembleWithoutPlaceholders(t *testing.T) {
+	instructionList := []instructions.Instruction{
+		{OpCode: instructions.INS_IPUSH, Params: []interface{}{1}},
+		{OpCode: instructions.INS_JMP, Params: []interface{}{0}},
+	}
+	labels := map[string]int{"loop": 1}
+
+	var buffer bytes.Buffer
+	if err := disassembler.Disassemble(&buffer, instructionList, &labels); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "L0:\nipush 1\nloop:\njmp L0\n"
+	if buffer.String() != expected {
+		t.Errorf("expected %q and got %q", expected, buffer.String())
+	}
+}
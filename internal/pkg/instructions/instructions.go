@@ -1,8 +1,11 @@
 package instructions
 
+import "fmt"
+
 type Instruction struct {
 	OpCode int
 	Params []interface{}
+	Line   int // source line the instruction was parsed from, 0 if unknown
 }
 
 const (
@@ -35,4 +38,189 @@ const (
 	INS_CALL           // calls procedure - same as goto but pushes value to reference stack
 	INS_DUMP           // print whole stack
 	INS_VOID           // do nothing
+	INS_FPUSH          // float push
+	INS_ANEW           // pushes a new empty array
+	INS_AGET           // pops index and array, pushes the element at index
+	INS_ASET           // pops value, index and array, sets the element at index and pushes the array back
+	INS_APUSH          // pops value and array, appends value and pushes the array back
+	INS_ASLICE         // pops end, start and array, pushes a new array with the elements from start to end
+	INS_ALEN           // pops array and pushes its length
+	INS_MNEW           // pushes a new empty map
+	INS_MPUT           // pops value, key and map, associates key with value and pushes the map back
+	INS_MGET           // pops default, key and map, pushes the value of key or default if it's missing
+	INS_MHAS           // pops key and map, pushes whether the map contains key
+	INS_MDEL           // pops key and map, removes key and pushes the map back
+	INS_MKEYS          // pops map and pushes an array of its keys in insertion order
+	INS_MLEN           // pops map and pushes its amount of entries
+	INS_READLN         // reads a line from input and pushes it without the line break
+	INS_READINT        // reads a line from input and pushes it as int
+	INS_READALL        // reads everything left from input and pushes it
+	INS_EOF            // pushes whether the input is exhausted
+	INS_RET            // returns from the current procedure, discarding its locals
+	INS_LOCAL          // pops head into a variable local to the current procedure
+	INS_ARG            // pushes the nth object the caller left on the stack, 0 being its head at the time of the call
+	INS_NATIVE         // calls a Go function registered on the interpreter
+	INS_TRY            // installs an exception handler at the given instruction
+	INS_ENDTRY         // removes the innermost exception handler
+	INS_THROW          // pops head and raises it as exception
 )
+
+// StackEffect describes how many objects an instruction takes from the
+// SickObjectStack and how many it puts back onto it. Instructions that only
+// inspect the head, like req, pop and push it again.
+type StackEffect struct {
+	Pops   int
+	Pushes int
+}
+
+var stackEffects = [...]StackEffect{
+	INS_IPUSH:   {0, 1},
+	INS_SPUSH:   {0, 1},
+	INS_BPUSH:   {0, 1},
+	INS_ADD:     {2, 1},
+	INS_SUB:     {2, 1},
+	INS_MUL:     {2, 1},
+	INS_DIV:     {2, 1},
+	INS_MOD:     {2, 1},
+	INS_CMP:     {2, 1},
+	INS_LT:      {2, 1},
+	INS_GT:      {2, 1},
+	INS_LTE:     {2, 1},
+	INS_GTE:     {2, 1},
+	INS_REQ:     {1, 1},
+	INS_STORE:   {1, 0},
+	INS_LOAD:    {0, 1},
+	INS_DEL:     {0, 0},
+	INS_JMP:     {0, 0},
+	INS_CJMP:    {1, 0},
+	INS_SIZEOF:  {1, 1},
+	INS_DUP:     {1, 2},
+	INS_SWAP:    {2, 2},
+	INS_DROP:    {1, 0},
+	INS_PRINT:   {1, 0},
+	INS_PRINTLN: {1, 0},
+	INS_GOTO:    {0, 0},
+	INS_CALL:    {0, 0},
+	INS_DUMP:    {0, 0},
+	INS_VOID:    {0, 0},
+	INS_FPUSH:   {0, 1},
+	INS_ANEW:    {0, 1},
+	INS_AGET:    {2, 1},
+	INS_ASET:    {3, 1},
+	INS_APUSH:   {2, 1},
+	INS_ASLICE:  {3, 1},
+	INS_ALEN:    {1, 1},
+	INS_MNEW:    {0, 1},
+	INS_MPUT:    {3, 1},
+	INS_MGET:    {3, 1},
+	INS_MHAS:    {2, 1},
+	INS_MDEL:    {2, 1},
+	INS_MKEYS:   {1, 1},
+	INS_MLEN:    {1, 1},
+	INS_READLN:  {0, 1},
+	INS_READINT: {0, 1},
+	INS_READALL: {0, 1},
+	INS_EOF:     {0, 1},
+	INS_RET:     {0, 0},
+	INS_LOCAL:   {1, 0},
+	INS_ARG:     {0, 1},
+	INS_NATIVE:  {0, 0},
+	INS_TRY:     {0, 0},
+	INS_ENDTRY:  {0, 0},
+	INS_THROW:   {1, 0},
+}
+
+// Effect returns the StackEffect of opCode. The effect of a procedure invoked
+// by call and of the function invoked by native aren't included.
+func Effect(opCode int) StackEffect {
+	if opCode < 0 || opCode >= len(stackEffects) {
+		return StackEffect{}
+	}
+
+	return stackEffects[opCode]
+}
+
+// IsJump reports whether the params of opCode are instruction indices.
+func IsJump(opCode int) bool {
+	return opCode == INS_JMP || opCode == INS_CJMP || opCode == INS_TRY
+}
+
+var mnemonics = map[int]string{
+	INS_IPUSH:   "ipush",
+	INS_SPUSH:   "spush",
+	INS_BPUSH:   "bpush",
+	INS_ADD:     "add",
+	INS_SUB:     "sub",
+	INS_MUL:     "mul",
+	INS_DIV:     "div",
+	INS_MOD:     "mod",
+	INS_CMP:     "cmp",
+	INS_LT:      "lt",
+	INS_GT:      "gt",
+	INS_LTE:     "lte",
+	INS_GTE:     "gte",
+	INS_REQ:     "req",
+	INS_STORE:   "store",
+	INS_LOAD:    "load",
+	INS_DEL:     "del",
+	INS_JMP:     "jmp",
+	INS_CJMP:    "cjmp",
+	INS_SIZEOF:  "sizeof",
+	INS_DUP:     "dup",
+	INS_SWAP:    "swap",
+	INS_DROP:    "drop",
+	INS_PRINT:   "print",
+	INS_PRINTLN: "println",
+	INS_GOTO:    "goto",
+	INS_CALL:    "call",
+	INS_DUMP:    "dump",
+	INS_VOID:    "void",
+	INS_FPUSH:   "fpush",
+	INS_ANEW:    "anew",
+	INS_AGET:    "aget",
+	INS_ASET:    "aset",
+	INS_APUSH:   "apush",
+	INS_ASLICE:  "aslice",
+	INS_ALEN:    "alen",
+	INS_MNEW:    "mnew",
+	INS_MPUT:    "mput",
+	INS_MGET:    "mget",
+	INS_MHAS:    "mhas",
+	INS_MDEL:    "mdel",
+	INS_MKEYS:   "mkeys",
+	INS_MLEN:    "mlen",
+	INS_READLN:  "readln",
+	INS_READINT: "readint",
+	INS_READALL: "readall",
+	INS_EOF:     "eof",
+	INS_RET:     "ret",
+	INS_LOCAL:   "local",
+	INS_ARG:     "arg",
+	INS_NATIVE:  "native",
+	INS_TRY:     "try",
+	INS_ENDTRY:  "endtry",
+	INS_THROW:   "throw",
+}
+
+var opCodes = make(map[string]int, len(mnemonics))
+
+func init() {
+	for opCode, mnemonic := range mnemonics {
+		opCodes[mnemonic] = opCode
+	}
+}
+
+// Mnemonic returns the name used for opCode in .sickc sources.
+func Mnemonic(opCode int) string {
+	if mnemonic, ok := mnemonics[opCode]; ok {
+		return mnemonic
+	}
+
+	return fmt.Sprintf("op(%v)", opCode)
+}
+
+// Lookup returns the opcode for a mnemonic used in .sickc sources.
+func Lookup(mnemonic string) (int, bool) {
+	opCode, ok := opCodes[mnemonic]
+	return opCode, ok
+}
@@ -0,0 +1,145 @@
+package instructions
+
+import "fmt"
+
+// Operand is the kind of a value an instruction takes in its Params.
+type Operand int
+
+const (
+	OperandInt        Operand = iota
+	OperandFloat              // stored as float64
+	OperandBool               // stored as bool
+	OperandString             // quoted in .sickc sources
+	OperandIdentifier         // unquoted name of a variable, type or label
+	OperandTarget             // instruction index, can be written as label name in .sickc sources
+)
+
+func (operand Operand) String() string {
+	switch operand {
+	case OperandInt:
+		return "int"
+	case OperandFloat:
+		return "float"
+	case OperandBool:
+		return "bool"
+	case OperandString:
+		return "string"
+	case OperandIdentifier:
+		return "identifier"
+	case OperandTarget:
+		return "jump target"
+	}
+
+	return fmt.Sprintf("operand(%v)", int(operand))
+}
+
+var operands = map[int][]Operand{
+	INS_IPUSH:   {OperandInt},
+	INS_SPUSH:   {OperandString},
+	INS_BPUSH:   {OperandBool},
+	INS_ADD:     {},
+	INS_SUB:     {},
+	INS_MUL:     {},
+	INS_DIV:     {},
+	INS_MOD:     {},
+	INS_CMP:     {},
+	INS_LT:      {},
+	INS_GT:      {},
+	INS_LTE:     {},
+	INS_GTE:     {},
+	INS_REQ:     {OperandIdentifier},
+	INS_STORE:   {OperandIdentifier},
+	INS_LOAD:    {OperandIdentifier},
+	INS_DEL:     {OperandIdentifier},
+	INS_JMP:     {OperandTarget},
+	INS_CJMP:    {OperandTarget, OperandTarget},
+	INS_SIZEOF:  {},
+	INS_DUP:     {},
+	INS_SWAP:    {},
+	INS_DROP:    {},
+	INS_PRINT:   {},
+	INS_PRINTLN: {},
+	INS_GOTO:    {OperandIdentifier},
+	INS_CALL:    {OperandIdentifier},
+	INS_DUMP:    {},
+	INS_VOID:    {},
+	INS_FPUSH:   {OperandFloat},
+	INS_ANEW:    {},
+	INS_AGET:    {},
+	INS_ASET:    {},
+	INS_APUSH:   {},
+	INS_ASLICE:  {},
+	INS_ALEN:    {},
+	INS_MNEW:    {},
+	INS_MPUT:    {},
+	INS_MGET:    {},
+	INS_MHAS:    {},
+	INS_MDEL:    {},
+	INS_MKEYS:   {},
+	INS_MLEN:    {},
+	INS_READLN:  {},
+	INS_READINT: {},
+	INS_READALL: {},
+	INS_EOF:     {},
+	INS_RET:     {},
+	INS_LOCAL:   {OperandIdentifier},
+	INS_ARG:     {OperandInt},
+	INS_NATIVE:  {OperandString},
+	INS_TRY:     {OperandTarget},
+	INS_ENDTRY:  {},
+	INS_THROW:   {},
+}
+
+// Operands returns the kinds of the params opCode takes and whether opCode exists.
+func Operands(opCode int) ([]Operand, bool) {
+	kinds, ok := operands[opCode]
+	return kinds, ok
+}
+
+// Validate checks that instruction has a known opcode and the params it
+// takes, with jump targets resolved to instruction indices. A void carrying
+// the name of the label it was parsed from is valid as well.
+func Validate(instruction Instruction) error {
+	kinds, ok := Operands(instruction.OpCode)
+	if !ok {
+		return fmt.Errorf("unknown opcode %v", instruction.OpCode)
+	}
+
+	if instruction.OpCode == INS_VOID && len(instruction.Params) == 1 {
+		if _, ok := instruction.Params[0].(string); ok {
+			return nil
+		}
+	}
+
+	mnemonic := Mnemonic(instruction.OpCode)
+	if len(instruction.Params) != len(kinds) {
+		return fmt.Errorf("%v requires %v parameters and got %v", mnemonic, len(kinds), len(instruction.Params))
+	}
+
+	for i, kind := range kinds {
+		param := instruction.Params[i]
+
+		var ok bool
+		switch kind {
+		case OperandInt:
+			_, ok = param.(int)
+		case OperandFloat:
+			_, ok = param.(float64)
+		case OperandBool:
+			_, ok = param.(bool)
+		case OperandString, OperandIdentifier:
+			_, ok = param.(string)
+		case OperandTarget:
+			var target int
+			if target, ok = param.(int); ok && target < 0 {
+				return fmt.Errorf("%v target %v is negative", mnemonic, target)
+			}
+		}
+
+		if !ok {
+			return fmt.Errorf("parameter %v of %v must be %v and is %v (%T)", i+1, mnemonic, kind, param, param)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package interpreter_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+)
+
+// counting is a hot loop of the kind superinstructions are made for.
+const counting = `ipush 0
+store i
+ipush 0
+store sum
+loop:
+load i
+ipush 100000
+lt
+cjmp body end
+body:
+load sum
+load i
+add
+store sum
+load i
+ipush 1
+add
+store i
+jmp loop
+end:
+load sum
+println`
+
+const fibonacci = `ipush 20
+call fib
+println
+jmp end
+fib:
+local n
+load n
+ipush 2
+lt
+cjmp base recurse
+base:
+load n
+ret
+recurse:
+load n
+ipush 1
+sub
+call fib
+load n
+ipush 2
+sub
+call fib
+add
+ret
+end:`
+
+func benchmark(b *testing.B, source string, options ...interpreter.Option) {
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	options = append(options, interpreter.WithStdout(ioutil.Discard))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := interpreter.NewInterpreter(instructionList, labels, options...).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The plain variants only leave out superinstructions, their programs are
+// still decoded up front. They don't show the speed of the interpreter from
+// before decoding was introduced.
+func BenchmarkCounting(b *testing.B) {
+	b.Run("superinstructions", func(b *testing.B) { benchmark(b, counting) })
+	b.Run("plain", func(b *testing.B) { benchmark(b, counting, interpreter.WithoutSuperinstructions()) })
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	b.Run("superinstructions", func(b *testing.B) { benchmark(b, fibonacci) })
+	b.Run("plain", func(b *testing.B) { benchmark(b, fibonacci, interpreter.WithoutSuperinstructions()) })
+}
@@ -0,0 +1,193 @@
+package interpreter
+
+import (
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// decoded is an instruction prepared for execution. Its operands are
+// converted once when the program is loaded instead of every time the
+// instruction is executed.
+type decoded struct {
+	opCode      int
+	effect      instructions.StackEffect
+	cost        int
+	object      types.SickObject // pushed by ipush, spush, bpush and fpush
+	name        string           // identifier, label or native
+	target      int              // jump target, or the index of the label of call and goto
+	alternative int              // target of cjmp if the condition is false
+	resolved    bool             // whether the label of call and goto exists
+	n           int              // argument of arg
+	super       *superinstruction
+	invalid     error // why an instruction with opCode opInvalid can't be executed
+}
+
+// opInvalid replaces the opcode of malformed instructions, so they fail
+// when they are executed instead of when the program is loaded.
+const opInvalid = -1
+
+const (
+	superIncrement   = iota // load x, ipush k, add, store x
+	superCompareJump        // ipush k, lt|gt|lte|gte|cmp, cjmp a b
+)
+
+// superinstruction executes a common sequence of instructions at once. It
+// only handles ints, for everything else the sequence is executed one
+// instruction after the other.
+type superinstruction struct {
+	kind      int
+	length    int // amount of instructions replaced
+	cost      int // gas of all replaced instructions
+	name      string
+	operand   int
+	compare   int // opcode of the comparison
+	whenTrue  int
+	whenFalse int
+}
+
+// decode prepares the instructions for execution. It has to be called
+// whenever instructions, labels or gas costs change.
+func (interpreter *Interpreter) decode() {
+	code := make([]decoded, len(interpreter.Instructions))
+	for i, instruction := range interpreter.Instructions {
+		op := decoded{opCode: instruction.OpCode, effect: instructions.Effect(instruction.OpCode), cost: interpreter.cost(instruction.OpCode)}
+		if err := instructions.Validate(instruction); err != nil {
+			code[i] = decoded{opCode: opInvalid, cost: op.cost, invalid: err}
+			continue
+		}
+
+		switch instruction.OpCode {
+		case instructions.INS_IPUSH, instructions.INS_SPUSH, instructions.INS_BPUSH, instructions.INS_FPUSH:
+			op.object = types.AnyToSickObject(instruction.Params[0])
+		case instructions.INS_REQ, instructions.INS_STORE, instructions.INS_LOCAL, instructions.INS_LOAD, instructions.INS_DEL, instructions.INS_NATIVE:
+			op.name = instruction.Params[0].(string)
+		case instructions.INS_CALL, instructions.INS_GOTO:
+			op.name = instruction.Params[0].(string)
+			op.target, op.resolved = (*interpreter.Labels)[op.name]
+		case instructions.INS_JMP, instructions.INS_TRY:
+			op.target = instruction.Params[0].(int)
+		case instructions.INS_CJMP:
+			op.target = instruction.Params[0].(int)
+			op.alternative = instruction.Params[1].(int)
+		case instructions.INS_ARG:
+			op.n = instruction.Params[0].(int)
+		}
+
+		code[i] = op
+	}
+
+	for i := range code {
+		code[i].super = interpreter.fuse(code, i)
+	}
+
+	interpreter.code = code
+}
+
+// fuse returns the superinstruction for the sequence starting at i, if there is one.
+func (interpreter *Interpreter) fuse(code []decoded, i int) *superinstruction {
+	if interpreter.disableFusion {
+		return nil
+	}
+
+	matches := func(opCodes ...int) bool {
+		if i+len(opCodes) > len(code) {
+			return false
+		}
+		for j, opCode := range opCodes {
+			if code[i+j].opCode != opCode {
+				return false
+			}
+		}
+		return true
+	}
+
+	cost := func(length int) int {
+		total := 0
+		for j := i; j < i+length; j++ {
+			total += code[j].cost
+		}
+		return total
+	}
+
+	if matches(instructions.INS_LOAD, instructions.INS_IPUSH, instructions.INS_ADD, instructions.INS_STORE) {
+		operand, isInt := code[i+1].object.(types.SickInt)
+		if isInt && code[i].name == code[i+3].name {
+			return &superinstruction{kind: superIncrement, length: 4, cost: cost(4), name: code[i].name, operand: operand.Value}
+		}
+	}
+
+	if i+2 < len(code) && code[i+2].opCode == instructions.INS_CJMP && code[i].opCode == instructions.INS_IPUSH {
+		operand, isInt := code[i].object.(types.SickInt)
+		switch compare := code[i+1].opCode; compare {
+		case instructions.INS_LT, instructions.INS_GT, instructions.INS_LTE, instructions.INS_GTE, instructions.INS_CMP:
+			if isInt {
+				return &superinstruction{kind: superCompareJump, length: 3, cost: cost(3), operand: operand.Value, compare: compare, whenTrue: code[i+2].target, whenFalse: code[i+2].alternative}
+			}
+		}
+	}
+
+	return nil
+}
+
+// executeSuper executes the superinstruction at i and returns the index of
+// the instruction to continue with. It does nothing and returns false if any
+// of the replaced instructions would fail or could behave differently, which
+// leaves the error handling to the instructions themselves.
+func (interpreter *Interpreter) executeSuper(super *superinstruction, i int) (int, bool) {
+	if interpreter.gasLimit > 0 && interpreter.gasUsed+super.cost > interpreter.gasLimit {
+		return 0, false
+	}
+
+	objectStack := &interpreter.objectStack
+	depth := len(*objectStack)
+
+	switch super.kind {
+	case superIncrement:
+		// load and ipush grow the stack by two before add and store shrink it again
+		if interpreter.maxStackDepth > 0 && depth+2 > interpreter.maxStackDepth {
+			return 0, false
+		}
+
+		value, _ := interpreter.lookup(super.name)
+		number, isInt := value.(types.SickInt)
+		if !isInt {
+			return 0, false
+		}
+
+		interpreter.assign(super.name, types.SickInt{Value: number.Value + super.operand})
+		interpreter.gasUsed += super.cost
+		return i + super.length, true
+	case superCompareJump:
+		if depth == 0 || (interpreter.maxStackDepth > 0 && depth+1 > interpreter.maxStackDepth) {
+			return 0, false
+		}
+
+		number, isInt := (*objectStack)[depth-1].(types.SickInt)
+		if !isInt {
+			return 0, false
+		}
+
+		var condition bool
+		switch super.compare {
+		case instructions.INS_LT:
+			condition = number.Value < super.operand
+		case instructions.INS_GT:
+			condition = number.Value > super.operand
+		case instructions.INS_LTE:
+			condition = number.Value <= super.operand
+		case instructions.INS_GTE:
+			condition = number.Value >= super.operand
+		case instructions.INS_CMP:
+			condition = number.Value == super.operand
+		}
+
+		*objectStack = (*objectStack)[:depth-1]
+		interpreter.gasUsed += super.cost
+		if condition {
+			return super.whenTrue, true
+		}
+		return super.whenFalse, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,97 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/operations"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+var (
+	ErrStackUnderflow = errors.New("stack underflow")
+	ErrStackOverflow  = errors.New("stack overflow")
+	ErrOutOfGas       = errors.New("out of gas")
+	ErrEndOfInput     = operations.ErrEndOfInput
+
+	ErrCallStackOverflow = errors.New("call stack overflow")
+)
+
+// stackSnapshotSize is the amount of SickObjectStack elements kept in a RuntimeError.
+const stackSnapshotSize = 8
+
+// TraceEntry points to a call instruction that is still waiting for its procedure to return.
+type TraceEntry struct {
+	Instruction int
+	Line        int
+}
+
+// RuntimeError is returned by the interpreter whenever executing an instruction fails.
+type RuntimeError struct {
+	OpCode      int
+	Instruction int // index of the failing instruction
+	Line        int // source line of the failing instruction, 0 if unknown
+	// Stack holds up to stackSnapshotSize elements from the top of the
+	// SickObjectStack at the time of the failure, the head being the last element.
+	Stack []types.SickObject
+	// Trace lists the pending calls, the outermost call first.
+	Trace []TraceEntry
+	Err   error
+}
+
+func (err *RuntimeError) Error() string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "runtime error at instruction %v (%v", err.Instruction, instructions.Mnemonic(err.OpCode))
+	if err.Line > 0 {
+		fmt.Fprintf(&builder, ", line %v", err.Line)
+	}
+	fmt.Fprintf(&builder, "): %v", err.Err)
+
+	for i := len(err.Trace) - 1; i >= 0; i-- {
+		entry := err.Trace[i]
+		fmt.Fprintf(&builder, "\n\tcalled from instruction %v", entry.Instruction)
+		if entry.Line > 0 {
+			fmt.Fprintf(&builder, " (line %v)", entry.Line)
+		}
+	}
+
+	return builder.String()
+}
+
+func (err *RuntimeError) Unwrap() error {
+	return err.Err
+}
+
+func (interpreter *Interpreter) newRuntimeError(index int, err error) *RuntimeError {
+	var trace []TraceEntry
+	for _, frame := range interpreter.frames {
+		callIndex := frame.returnAddress - 1
+		trace = append(trace, TraceEntry{callIndex, interpreter.Instructions[callIndex].Line})
+	}
+
+	return NewRuntimeError(interpreter.Instructions[index], index, interpreter.objectStack, trace, err)
+}
+
+// NewRuntimeError describes err raised by the instruction at index, which
+// found stack when it started. It lets other backends fail like the
+// interpreter does.
+func NewRuntimeError(instruction instructions.Instruction, index int, stack []types.SickObject, trace []TraceEntry, err error) *RuntimeError {
+	snapshotStart := len(stack) - stackSnapshotSize
+	if snapshotStart < 0 {
+		snapshotStart = 0
+	}
+	snapshot := make([]types.SickObject, len(stack)-snapshotStart)
+	copy(snapshot, stack[snapshotStart:])
+
+	return &RuntimeError{
+		OpCode:      instruction.OpCode,
+		Instruction: index,
+		Line:        instruction.Line,
+		Stack:       snapshot,
+		Trace:       trace,
+		Err:         err,
+	}
+}
@@ -0,0 +1,60 @@
+package interpreter_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden output of the examples")
+
+// TestExamples runs every example and compares what it writes to stdout and
+// stderr with the .out file next to it.
+func TestExamples(t *testing.T) {
+	files, err := filepath.Glob("../../../examples/*.sickc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		instructionList, labels, err := parser.NewParser().ParseFile(file, string(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var output bytes.Buffer
+		vm := interpreter.NewInterpreter(instructionList, labels, interpreter.WithStdout(&output), interpreter.WithStderr(&output), interpreter.WithStdin(strings.NewReader("")))
+		if err := vm.Run(); err != nil {
+			t.Errorf("%v: %v", file, err)
+			continue
+		}
+
+		golden := strings.TrimSuffix(file, filepath.Ext(file)) + ".out"
+		if *update {
+			if err := ioutil.WriteFile(golden, output.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(output.Bytes(), expected) {
+			t.Errorf("%v: output differs from %v:\n%v", file, golden, output.String())
+		}
+	}
+}
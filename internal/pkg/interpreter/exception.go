@@ -0,0 +1,61 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// Exception is the error raised by the throw instruction.
+type Exception struct {
+	Value types.SickObject
+}
+
+func (exception *Exception) Error() string {
+	return fmt.Sprintf("uncaught exception: %v", types.Format(exception.Value))
+}
+
+// handler is installed by try and removed by endtry. It remembers the state
+// to unwind to before continuing at its target.
+type handler struct {
+	target     int
+	stackDepth int
+	frameDepth int
+}
+
+// catch hands err to the innermost handler. It unwinds the object stack and
+// call frames to where they were at the try, pushes the thrown value or the
+// error message and returns the index of the handler code. depth is the size
+// of the stack without the operands of the failing instruction, these are
+// dropped even if the stack is already below where it was at the try. Running
+// out of gas can't be caught, otherwise a handler could keep a program
+// running forever.
+func (interpreter *Interpreter) catch(err error, depth int) (int, bool) {
+	if len(interpreter.handlers) == 0 || errors.Is(err, ErrOutOfGas) {
+		return 0, false
+	}
+
+	last := len(interpreter.handlers) - 1
+	handler := interpreter.handlers[last]
+	interpreter.handlers = interpreter.handlers[:last]
+
+	if depth > handler.stackDepth {
+		depth = handler.stackDepth
+	}
+	interpreter.objectStack = interpreter.objectStack[:depth]
+	for len(interpreter.frames) > handler.frameDepth {
+		interpreter.popFrame()
+	}
+
+	var value types.SickObject
+	var exception *Exception
+	if errors.As(err, &exception) {
+		value = exception.Value
+	} else {
+		value = types.SickString{Value: err.Error()}
+	}
+	interpreter.objectStack.Push(value)
+
+	return handler.target, true
+}
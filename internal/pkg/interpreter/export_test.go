@@ -0,0 +1,9 @@
+package interpreter
+
+// WithoutSuperinstructions executes every instruction on its own, which lets
+// benchmarks measure what superinstructions gain.
+func WithoutSuperinstructions() Option {
+	return func(interpreter *Interpreter) {
+		interpreter.disableFusion = true
+	}
+}
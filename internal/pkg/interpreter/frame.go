@@ -0,0 +1,82 @@
+package interpreter
+
+import "mvmo.dev/sickvm/internal/pkg/types"
+
+// DefaultMaxCallDepth limits recursion unless WithMaxCallDepth says otherwise.
+const DefaultMaxCallDepth = 10000
+
+// frame is pushed by call and popped by ret. It remembers where to continue
+// once the procedure returns and holds the variables declared with local.
+type frame struct {
+	returnAddress int
+	base          int // depth of the object stack when the procedure was called
+	locals        map[string]types.SickObject
+}
+
+func (interpreter *Interpreter) currentFrame() *frame {
+	if len(interpreter.frames) == 0 {
+		return nil
+	}
+	return &interpreter.frames[len(interpreter.frames)-1]
+}
+
+// lookup resolves identifier in the locals of the current frame first and
+// in the global storage after that.
+func (interpreter *Interpreter) lookup(identifier string) (types.SickObject, bool) {
+	if frame := interpreter.currentFrame(); frame != nil {
+		if value, ok := frame.locals[identifier]; ok {
+			return value, true
+		}
+	}
+
+	value, ok := interpreter.storage[identifier]
+	return value, ok
+}
+
+// assign updates a local of the current frame if it has one called
+// identifier, otherwise the global storage.
+func (interpreter *Interpreter) assign(identifier string, value types.SickObject) {
+	if frame := interpreter.currentFrame(); frame != nil {
+		if _, ok := frame.locals[identifier]; ok {
+			frame.locals[identifier] = value
+			return
+		}
+	}
+
+	interpreter.storage[identifier] = value
+}
+
+// declareLocal stores value in the current frame, shadowing a global with the
+// same identifier. Outside of a procedure the value is stored globally.
+func (interpreter *Interpreter) declareLocal(identifier string, value types.SickObject) {
+	frame := interpreter.currentFrame()
+	if frame == nil {
+		interpreter.storage[identifier] = value
+		return
+	}
+
+	if frame.locals == nil {
+		frame.locals = make(map[string]types.SickObject)
+	}
+	frame.locals[identifier] = value
+}
+
+func (interpreter *Interpreter) remove(identifier string) {
+	if frame := interpreter.currentFrame(); frame != nil {
+		if _, ok := frame.locals[identifier]; ok {
+			delete(frame.locals, identifier)
+			return
+		}
+	}
+
+	delete(interpreter.storage, identifier)
+}
+
+// Locals returns the variables declared with local in the innermost pending
+// call. The map is owned by the interpreter and must not be modified.
+func (interpreter *Interpreter) Locals() map[string]types.SickObject {
+	if frame := interpreter.currentFrame(); frame != nil {
+		return frame.locals
+	}
+	return nil
+}
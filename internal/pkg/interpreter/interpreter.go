@@ -1,215 +1,547 @@
 package interpreter
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"os"
 
 	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/operations"
 	"mvmo.dev/sickvm/internal/pkg/types"
 )
 
+// Interpreter executes a program. Instructions and Labels must not be
+// modified after NewInterpreter, Append is the only way to change them.
 type Interpreter struct {
 	Instructions []instructions.Instruction
 	Labels       *map[string]int
+
+	code          []decoded
+	disableFusion bool // executes superinstructions as separate instructions, only used by benchmarks
+
+	maxStackDepth int
+	maxCallDepth  int
+	gasLimit      int
+	gasCosts      map[int]int
+	gasUsed       int
+
+	stdout io.Writer
+	stderr io.Writer // receives diagnostics like the output of dump
+	stdin  *bufio.Reader
+
+	pc          int
+	objectStack SickObjectStack
+	frames      []frame
+	storage     map[string]types.SickObject
+	natives     map[string]native
+	handlers    []handler
+}
+
+// Option configures optional behaviour of an Interpreter.
+type Option func(*Interpreter)
+
+// WithMaxStackDepth limits the amount of objects on the SickObjectStack.
+// A depth of 0 means no limit, which is the default.
+func WithMaxStackDepth(depth int) Option {
+	return func(interpreter *Interpreter) {
+		interpreter.maxStackDepth = depth
+	}
+}
+
+// WithMaxCallDepth limits how many calls can be pending at once, which
+// stops runaway recursion. It defaults to 10000.
+func WithMaxCallDepth(depth int) Option {
+	return func(interpreter *Interpreter) {
+		interpreter.maxCallDepth = depth
+	}
+}
+
+// WithGasLimit stops execution with ErrOutOfGas once the instructions
+// executed would consume more than limit gas. A limit of 0 means no limit.
+func WithGasLimit(limit int) Option {
+	return func(interpreter *Interpreter) {
+		interpreter.gasLimit = limit
+	}
+}
+
+// WithGasCosts sets how much gas an instruction consumes by opcode,
+// instructions without an entry cost 1. It panics on a negative cost, which
+// would hand out gas instead of consuming it.
+func WithGasCosts(costs map[int]int) Option {
+	for opCode, cost := range costs {
+		if cost < 0 {
+			panic(fmt.Sprintf("interpreter: negative gas cost %v for %v", cost, instructions.Mnemonic(opCode)))
+		}
+	}
+
+	return func(interpreter *Interpreter) {
+		interpreter.gasCosts = costs
+	}
 }
 
-func NewInterpreter(instructions []instructions.Instruction, Labels *map[string]int) Interpreter {
+// WithStdout sets where print and println write to, os.Stdout by default.
+func WithStdout(w io.Writer) Option {
+	return func(interpreter *Interpreter) {
+		interpreter.stdout = w
+	}
+}
+
+// WithStderr sets where diagnostics like the output of dump are written to, os.Stderr by default.
+func WithStderr(w io.Writer) Option {
+	return func(interpreter *Interpreter) {
+		interpreter.stderr = w
+	}
+}
+
+// WithStdin sets where input is read from, os.Stdin by default.
+func WithStdin(r io.Reader) Option {
+	return func(interpreter *Interpreter) {
+		interpreter.stdin = bufio.NewReader(r)
+	}
+}
+
+func NewInterpreter(instructions []instructions.Instruction, Labels *map[string]int, options ...Option) *Interpreter {
 	interpreter := new(Interpreter)
 	interpreter.Instructions = instructions
 	interpreter.Labels = Labels
+	interpreter.storage = make(map[string]types.SickObject)
+	interpreter.maxCallDepth = DefaultMaxCallDepth
+	interpreter.stdout = os.Stdout
+	interpreter.stderr = os.Stderr
 
-	return *interpreter
+	if interpreter.Labels == nil {
+		interpreter.Labels = &map[string]int{}
+	}
+
+	for _, option := range options {
+		option(interpreter)
+	}
+
+	if interpreter.stdin == nil {
+		interpreter.stdin = bufio.NewReader(os.Stdin)
+	}
+
+	interpreter.decode()
+	return interpreter
 }
 
-func (interpreter Interpreter) Run() error {
-	var objectStack SickObjectStack
-	var referenceStack Stack
-	var storage map[string]types.SickObject = make(map[string]types.SickObject)
+// Stack returns a copy of the SickObjectStack, the head being the last element.
+func (interpreter *Interpreter) Stack() []types.SickObject {
+	stack := make([]types.SickObject, len(interpreter.objectStack))
+	copy(stack, interpreter.objectStack)
+	return stack
+}
 
-	for i := 0; i < len(interpreter.Instructions); i++ {
-		instruction := interpreter.Instructions[i]
+// Storage returns the global values stored by identifier. The map is owned by the
+// interpreter and must not be modified.
+func (interpreter *Interpreter) Storage() map[string]types.SickObject {
+	return interpreter.storage
+}
 
-		switch instruction.OpCode {
+// ReferenceStack returns the return addresses of the pending calls, the innermost call last.
+func (interpreter *Interpreter) ReferenceStack() []int {
+	references := make([]int, len(interpreter.frames))
+	for i, frame := range interpreter.frames {
+		references[i] = frame.returnAddress
+	}
+	return references
+}
+
+// Push puts value onto the SickObjectStack.
+func (interpreter *Interpreter) Push(value types.SickObject) {
+	interpreter.objectStack.Push(value)
+}
+
+// Store associates identifier with value like the store instruction does.
+func (interpreter *Interpreter) Store(identifier string, value types.SickObject) {
+	interpreter.storage[identifier] = value
+}
+
+// Append adds instructions and their labels to the end of the program and
+// makes the next Run start with them, keeping the stack and storage intact.
+// Jump targets and labels are relative to the appended instructions.
+func (interpreter *Interpreter) Append(instructionList []instructions.Instruction, labels *map[string]int) {
+	base := len(interpreter.Instructions)
+
+	for _, instruction := range instructionList {
+		if instructions.IsJump(instruction.OpCode) {
+			params := make([]interface{}, len(instruction.Params))
+			for i, param := range instruction.Params {
+				// malformed params are left to fail when they are executed
+				if target, ok := param.(int); ok {
+					param = target + base
+				}
+				params[i] = param
+			}
+			instruction.Params = params
+		}
+		interpreter.Instructions = append(interpreter.Instructions, instruction)
+	}
+
+	if labels != nil {
+		for name, index := range *labels {
+			(*interpreter.Labels)[name] = index + base
+		}
+	}
+
+	interpreter.decode()
+	interpreter.pc = base
+}
+
+// Unwind drops all pending calls and installed exception handlers, which is
+// needed before continuing with other instructions after an error.
+func (interpreter *Interpreter) Unwind() {
+	interpreter.frames = nil
+	interpreter.handlers = nil
+}
+
+// Run executes the program until it ends or fails. Running again after an
+// error retries the failing instruction.
+func (interpreter *Interpreter) Run() error {
+	return interpreter.execute(-1)
+}
+
+// contextCheckInterval is the amount of instructions RunContext executes
+// between checks of its context. Checking for every instruction would slow
+// down the dispatch loop considerably.
+const contextCheckInterval = 1024
+
+// RunContext is like Run, but stops with an error wrapping ctx.Err() once ctx is done.
+func (interpreter *Interpreter) RunContext(ctx context.Context) error {
+	for !interpreter.Halted() {
+		if err := ctx.Err(); err != nil {
+			return interpreter.newRuntimeError(interpreter.pc, err)
+		}
+
+		if err := interpreter.execute(contextCheckInterval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step executes the instruction at the program counter. Stepping a halted
+// interpreter does nothing.
+func (interpreter *Interpreter) Step() error {
+	return interpreter.execute(1)
+}
+
+// RunFor executes at most n instructions and stops early if the program ends or fails.
+func (interpreter *Interpreter) RunFor(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	return interpreter.execute(n)
+}
+
+// GasUsed returns the gas consumed by all instructions executed so far.
+func (interpreter *Interpreter) GasUsed() int {
+	return interpreter.gasUsed
+}
+
+// Halted reports whether the program counter moved past the last instruction.
+func (interpreter *Interpreter) Halted() bool {
+	return interpreter.pc >= len(interpreter.Instructions)
+}
+
+// PC returns the index of the instruction that is executed next.
+func (interpreter *Interpreter) PC() int {
+	return interpreter.pc
+}
+
+// execute runs at most limit instructions, or until the program ends if limit is negative.
+func (interpreter *Interpreter) execute(limit int) error {
+	objectStack := &interpreter.objectStack
+	code := interpreter.code
+
+	// the operands of the current instruction, put back onto the stack if it fails
+	var operands [3]types.SickObject
+
+	i := interpreter.pc
+	for n := 0; i < len(code) && n != limit; i, n = i+1, n+1 {
+		op := &code[i]
+		depth := len(*objectStack)
+
+		if op.super != nil && (limit < 0 || limit-n >= op.super.length) {
+			if next, ok := interpreter.executeSuper(op.super, i); ok {
+				i, n = next-1, n+op.super.length-1
+				continue
+			}
+		}
+
+		// checked here instead of in checkStack to keep the call out of the dispatch loop
+		if depth < op.effect.Pops || (interpreter.maxStackDepth > 0 && depth-op.effect.Pops+op.effect.Pushes > interpreter.maxStackDepth) {
+			err := interpreter.checkStack(i, op.opCode, depth)
+			if target, ok := interpreter.catch(err, depth); ok {
+				i = target - 1
+				continue
+			}
+			interpreter.pc = i
+			return interpreter.newRuntimeError(i, err)
+		}
+
+		if err := interpreter.consumeGas(op.opCode, op.cost); err != nil {
+			interpreter.pc = i
+			return interpreter.newRuntimeError(i, err)
+		}
+
+		copy(operands[:], (*objectStack)[depth-op.effect.Pops:])
+
+		var err error
+		switch op.opCode {
 		case instructions.INS_IPUSH:
-			objectStack.Push(types.AnyToSickObject(instruction.Params[0]))
+			objectStack.PushObject(op.object)
 			continue
 		case instructions.INS_SPUSH:
-			objectStack.Push(types.AnyToSickObject(instruction.Params[0]))
+			objectStack.PushObject(op.object)
 			continue
 		case instructions.INS_BPUSH:
-			objectStack.Push(types.AnyToSickObject(instruction.Params[0]))
+			objectStack.PushObject(op.object)
 			continue
-		case instructions.INS_ADD:
-			a := objectStack.Pop()
-			b := objectStack.Pop()
-
-			switch a := a.(type) {
-			case types.Addable:
-				result, err := a.Add(b)
-				if err != nil {
-					return err
-				}
-				objectStack.Push(result)
-			default:
-				return fmt.Errorf("+ doesnt not work -- better error message")
-			}
-
-			continue
-		case instructions.INS_SUB:
-			val1 := objectStack.Pop()
-			val2 := objectStack.Pop()
-
-			switch val1 := val1.(type) {
-			case types.SickInt:
-				switch val2 := val2.(type) {
-				case types.SickString:
-					value := val2.Value
-					objectStack.Push(value[:len(value)-val1.Value])
-				case types.SickInt:
-					objectStack.Push(val2.AsInt() - val1.AsInt())
-				default:
-					return fmt.Errorf("can't invoke Sub-Instruction with [%v(%v) - %v(%v)]", val2.ToHuman(), val2.TypeName(), val1.ToHuman(), val1.TypeName())
-				}
-			default:
-				return fmt.Errorf("can't invoke Sub-Instruction with [%v(%v) - %v(%v)]", val2.ToHuman(), val2.TypeName(), val1.ToHuman(), val1.TypeName())
-			}
-			continue
-		case instructions.INS_MUL:
-			val1 := objectStack.Pop().(types.SickNum)
-			val2 := objectStack.Pop().(types.SickNum)
-			objectStack.Push(val2.AsInt() * val1.AsInt())
-			continue
-		case instructions.INS_DIV:
-			val1 := objectStack.Pop().(types.SickNum)
-			val2 := objectStack.Pop().(types.SickNum)
-			objectStack.Push(val2.AsInt() / val1.AsInt())
-			continue
-		case instructions.INS_MOD:
-			val1 := objectStack.Pop().(types.SickNum)
-			val2 := objectStack.Pop().(types.SickNum)
-			objectStack.Push(val2.AsInt() % val1.AsInt())
-			continue
-		case instructions.INS_CMP:
-			val1 := objectStack.Pop()
-			val2 := objectStack.Pop()
-			objectStack.Push(val1 == val2)
-			continue
-		case instructions.INS_LT:
-			val1 := objectStack.Pop().(types.SickNum)
-			val2 := objectStack.Pop().(types.SickNum)
-			objectStack.Push(val2.AsFloat() < val1.AsFloat())
-			continue
-		case instructions.INS_GT:
-			val1 := objectStack.Pop().(types.SickNum)
-			val2 := objectStack.Pop().(types.SickNum)
-			objectStack.Push(val2.AsFloat() > val1.AsFloat())
-			continue
-		case instructions.INS_LTE:
-			val1 := objectStack.Pop().(types.SickNum)
-			val2 := objectStack.Pop().(types.SickNum)
-			objectStack.Push(val2.AsFloat() <= val1.AsFloat())
-			continue
-		case instructions.INS_GTE:
-			val1 := objectStack.Pop().(types.SickNum)
-			val2 := objectStack.Pop().(types.SickNum)
-			objectStack.Push(val2.AsFloat() >= val1.AsFloat())
+		case instructions.INS_FPUSH:
+			objectStack.PushObject(op.object)
+			continue
+		case instructions.INS_ADD, instructions.INS_SUB, instructions.INS_MUL, instructions.INS_DIV, instructions.INS_MOD,
+			instructions.INS_CMP, instructions.INS_LT, instructions.INS_GT, instructions.INS_LTE, instructions.INS_GTE:
+			var result types.SickObject
+			if result, err = operations.Binary(op.opCode, operands[0], operands[1]); err != nil {
+				break
+			}
+			*objectStack = append((*objectStack)[:depth-2], result)
 			continue
 		case instructions.INS_REQ:
-			requiredType := instruction.Params[0].(string)
-			typeOfSickObjectStackHead := objectStack.Peek().TypeName()
-
-			if typeOfSickObjectStackHead != requiredType {
-				return fmt.Errorf("required type %v and got %v", requiredType, typeOfSickObjectStackHead)
+			if err = operations.Require(objectStack.Peek(), op.name); err != nil {
+				break
 			}
-
 			continue
 		case instructions.INS_STORE:
-			identifier := instruction.Params[0].(string)
+			identifier := op.name
 			toStore := objectStack.Pop()
-			storage[identifier] = toStore
+			interpreter.assign(identifier, toStore)
+			continue
+		case instructions.INS_LOCAL:
+			identifier := op.name
+			interpreter.declareLocal(identifier, objectStack.Pop())
 			continue
 		case instructions.INS_LOAD:
-			identifier := instruction.Params[0].(string)
-			toPush := storage[identifier]
-			objectStack.Push(toPush)
+			identifier := op.name
+			toPush, ok := interpreter.lookup(identifier)
+			if !ok {
+				err = fmt.Errorf("undefined identifier %v", identifier)
+				break
+			}
+			objectStack.PushObject(toPush)
 			continue
 		case instructions.INS_DEL:
-			identifier := instruction.Params[0].(string)
-			delete(storage, identifier)
+			identifier := op.name
+			interpreter.remove(identifier)
 			continue
 		case instructions.INS_JMP:
-			whereToJump := instruction.Params[0].(int)
-			i = whereToJump - 1
+			i = op.target - 1
 			continue
 		case instructions.INS_CJMP: // first param is where to jump if true and second where to jump if false
-			condition := objectStack.Pop().(types.SickBool)
-			var whereToJump int
-			if condition.Value {
-				whereToJump = instruction.Params[0].(int) - 1
+			var condition bool
+			if condition, err = operations.Condition(objectStack.Pop()); err != nil {
+				break
+			}
+			if condition {
+				i = op.target - 1
 			} else {
-				whereToJump = instruction.Params[1].(int) - 1
+				i = op.alternative - 1
 			}
-
-			i = whereToJump
 			continue
 		case instructions.INS_SIZEOF:
-			head := objectStack.Pop()
-			switch head := head.(type) {
-			case types.SickString:
-				objectStack.Push(len(head.Value))
-			default:
-				return fmt.Errorf("can't use sizeof on %v", head.TypeName())
+			var size types.SickObject
+			if size, err = operations.Sizeof(objectStack.Pop()); err != nil {
+				break
 			}
+			objectStack.PushObject(size)
 			continue
 		case instructions.INS_SWAP:
 			a := objectStack.Pop()
 			b := objectStack.Pop()
-			objectStack.Push(b)
-			objectStack.Push(a)
+			objectStack.PushObject(a)
+			objectStack.PushObject(b)
+			continue
 		case instructions.INS_DUP:
 			head := objectStack.Pop()
-			objectStack.Push(head)
-			objectStack.Push(head)
+			objectStack.PushObject(head)
+			objectStack.PushObject(head)
 			continue
 		case instructions.INS_DROP:
 			objectStack.Pop()
 			continue
 		case instructions.INS_PRINT:
 			head := objectStack.Pop()
-			fmt.Print(head.ToHuman())
+			if _, err = fmt.Fprint(interpreter.stdout, head.ToHuman()); err != nil {
+				break
+			}
 			continue
 		case instructions.INS_PRINTLN:
 			head := objectStack.Pop()
-			fmt.Println(head.ToHuman())
+			if _, err = fmt.Fprintln(interpreter.stdout, head.ToHuman()); err != nil {
+				break
+			}
 			continue
 		case instructions.INS_CALL:
-			labelName := instruction.Params[0].(string)
-			referenceStack.Push(i + 1)
-			i = (*interpreter.Labels)[labelName] - 1
+			if !op.resolved {
+				if _, isNative := interpreter.natives[op.name]; isNative {
+					if err = interpreter.callNative(op.name); err != nil {
+						break
+					}
+					continue
+				}
+				err = fmt.Errorf("undefined label %v", op.name)
+				break
+			}
+			if interpreter.maxCallDepth > 0 && len(interpreter.frames) >= interpreter.maxCallDepth {
+				err = fmt.Errorf("%w: more than %v pending calls", ErrCallStackOverflow, interpreter.maxCallDepth)
+				break
+			}
+			interpreter.frames = append(interpreter.frames, frame{returnAddress: i + 1, base: len(*objectStack)})
+			i = op.target - 1
+			continue
+		case instructions.INS_NATIVE:
+			if err = interpreter.callNative(op.name); err != nil {
+				break
+			}
+			continue
+		case instructions.INS_TRY:
+			interpreter.handlers = append(interpreter.handlers, handler{op.target, len(*objectStack), len(interpreter.frames)})
+			continue
+		case instructions.INS_ENDTRY:
+			if len(interpreter.handlers) == 0 {
+				err = fmt.Errorf("endtry without try")
+				break
+			}
+			interpreter.handlers = interpreter.handlers[:len(interpreter.handlers)-1]
+			continue
+		case instructions.INS_THROW:
+			err = &Exception{objectStack.Pop()}
+		case instructions.INS_RET:
+			if len(interpreter.frames) == 0 {
+				err = fmt.Errorf("ret without a pending call")
+				break
+			}
+			i = interpreter.popFrame() - 1
+			continue
+		case instructions.INS_ARG:
+			n := op.n
+			frame := interpreter.currentFrame()
+			if frame == nil {
+				err = fmt.Errorf("arg outside of a procedure")
+				break
+			}
+			if n < 0 || n >= frame.base || frame.base-1-n >= len(*objectStack) {
+				err = fmt.Errorf("argument %v is out of range, the caller left %v objects", n, frame.base)
+				break
+			}
+			objectStack.Push((*objectStack)[frame.base-1-n])
 			continue
 		case instructions.INS_GOTO:
-			labelName := instruction.Params[0].(string)
-			if labelName == "$" {
-				i = referenceStack.Pop().(int) - 1
+			if op.name == "$" {
+				if len(interpreter.frames) == 0 {
+					err = fmt.Errorf("goto $ without a pending call")
+					break
+				}
+				i = interpreter.popFrame() - 1
 				continue
 			}
-			i = (*interpreter.Labels)[labelName] - 1
+			if !op.resolved {
+				err = fmt.Errorf("undefined label %v", op.name)
+				break
+			}
+			i = op.target - 1
 			continue
 		case instructions.INS_DUMP:
-			fmt.Printf("=== SickObjectStack Dump ===\n")
-			for i := len(objectStack); i > 0; i-- {
-				var anno string
-				if len(objectStack) == i {
-					anno = "   <-- head"
-				}
-				fmt.Printf("%v: %v%v\n", i, objectStack[i-1].ToHuman(), anno)
+			if err = operations.Dump(interpreter.stderr, *objectStack); err != nil {
+				break
 			}
-			fmt.Printf("==================\n")
 			continue
 		case instructions.INS_VOID:
 			continue
+		case instructions.INS_ANEW, instructions.INS_AGET, instructions.INS_ASET, instructions.INS_APUSH, instructions.INS_ASLICE, instructions.INS_ALEN,
+			instructions.INS_MNEW, instructions.INS_MPUT, instructions.INS_MGET, instructions.INS_MHAS, instructions.INS_MDEL, instructions.INS_MKEYS, instructions.INS_MLEN:
+			var result types.SickObject
+			if result, err = operations.Collection(op.opCode, operands[:op.effect.Pops]); err != nil {
+				break
+			}
+			*objectStack = append((*objectStack)[:depth-op.effect.Pops], result)
+			continue
+		case instructions.INS_READLN, instructions.INS_READINT, instructions.INS_READALL, instructions.INS_EOF:
+			var result types.SickObject
+			if result, err = operations.Read(op.opCode, interpreter.stdin); err != nil {
+				break
+			}
+			objectStack.PushObject(result)
+			continue
+		case opInvalid:
+			err = op.invalid
 		default:
-			return fmt.Errorf("Interpreter: No handling for instruction: %v", instruction.OpCode)
+			err = fmt.Errorf("no handling for instruction: %v", op.opCode)
 		}
+
+		// Instructions fail before pushing anything. Put back the operands they
+		// popped so the error shows the stack as it was when the instruction started.
+		*objectStack = append((*objectStack)[:depth-op.effect.Pops], operands[:op.effect.Pops]...)
+		if target, ok := interpreter.catch(err, depth-op.effect.Pops); ok {
+			i = target - 1
+			continue
+		}
+		interpreter.pc = i
+		return interpreter.newRuntimeError(i, err)
+	}
+
+	interpreter.pc = i
+	return nil
+}
+
+// cost returns the gas an instruction consumes.
+func (interpreter *Interpreter) cost(opCode int) int {
+	if opCost, ok := interpreter.gasCosts[opCode]; ok {
+		return opCost
+	}
+	return 1
+}
+
+// consumeGas charges the cost of an instruction unless that exceeds the gas limit.
+func (interpreter *Interpreter) consumeGas(opCode int, cost int) error {
+	if interpreter.gasLimit > 0 && interpreter.gasUsed+cost > interpreter.gasLimit {
+		return fmt.Errorf("%w: used %v of %v, %v needs %v more", ErrOutOfGas, interpreter.gasUsed, interpreter.gasLimit, instructions.Mnemonic(opCode), cost)
 	}
+
+	interpreter.gasUsed += cost
 	return nil
 }
+
+// checkStack makes sure the instruction at index finds enough operands on a
+// stack of the given depth and doesn't grow it beyond the maximum depth.
+func (interpreter *Interpreter) checkStack(index int, opCode int, depth int) error {
+	effect := instructions.Effect(opCode)
+
+	if depth < effect.Pops {
+		return fmt.Errorf("%w at instruction %v (%v needs %v, have %v)", ErrStackUnderflow, index, instructions.Mnemonic(opCode), effect.Pops, depth)
+	}
+
+	if interpreter.maxStackDepth > 0 && depth-effect.Pops+effect.Pushes > interpreter.maxStackDepth {
+		return fmt.Errorf("%w at instruction %v (%v pushes %v, have %v of %v)", ErrStackOverflow, index, instructions.Mnemonic(opCode), effect.Pushes, depth, interpreter.maxStackDepth)
+	}
+
+	return nil
+}
+
+// popFrame removes the innermost frame and returns its return address.
+func (interpreter *Interpreter) popFrame() int {
+	last := len(interpreter.frames) - 1
+	returnAddress := interpreter.frames[last].returnAddress
+	interpreter.frames[last] = frame{}
+	interpreter.frames = interpreter.frames[:last]
+
+	// handlers installed by the procedure don't outlive it
+	for len(interpreter.handlers) > 0 && interpreter.handlers[len(interpreter.handlers)-1].frameDepth > last {
+		interpreter.handlers = interpreter.handlers[:len(interpreter.handlers)-1]
+	}
+	return returnAddress
+}
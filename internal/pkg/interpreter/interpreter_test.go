@@ -0,0 +1,522 @@
+package interpreter_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+func run(t *testing.T, source string, options ...interpreter.Option) error {
+	t.Helper()
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return interpreter.NewInterpreter(instructionList, labels, options...).Run()
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	testCases := []struct {
+		source      string
+		opCode      int
+		instruction int
+		line        int
+		trace       int
+	}{
+		{"spush \"a\"\nipush 2\nmul", instructions.INS_MUL, 2, 3, 0},
+		{"ipush 1\nipush 0\ndiv", instructions.INS_DIV, 2, 3, 0},
+		{"bpush true\nipush 1\nadd", instructions.INS_ADD, 2, 3, 0},
+		{"ipush 1\ncjmp 0 0", instructions.INS_CJMP, 1, 2, 0},
+		{"load missing", instructions.INS_LOAD, 0, 1, 0},
+		{"call missing", instructions.INS_CALL, 0, 1, 0},
+		{"goto $", instructions.INS_GOTO, 0, 1, 0},
+		{"call proc\nproc:\nipush 1\nreq sick::string", instructions.INS_REQ, 3, 4, 1},
+	}
+
+	for _, testCase := range testCases {
+		err := run(t, testCase.source)
+
+		var runtimeErr *interpreter.RuntimeError
+		if !errors.As(err, &runtimeErr) {
+			t.Errorf("%q: expected RuntimeError and got %v", testCase.source, err)
+			continue
+		}
+
+		if runtimeErr.OpCode != testCase.opCode || runtimeErr.Instruction != testCase.instruction || runtimeErr.Line != testCase.line || len(runtimeErr.Trace) != testCase.trace {
+			t.Errorf("%q: unexpected error %+v", testCase.source, runtimeErr)
+		}
+	}
+}
+
+func TestRuntimeErrorKeepsOperands(t *testing.T) {
+	err := run(t, "ipush 7\nspush \"a\"\nipush 2\nmul")
+
+	var runtimeErr *interpreter.RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected RuntimeError and got %v", err)
+	}
+
+	if len(runtimeErr.Stack) != 3 || runtimeErr.Stack[2].ToHuman() != "2" {
+		t.Errorf("expected operands on the stack snapshot and got %v", runtimeErr.Stack)
+	}
+
+	// aset pops its value and index before it finds out that there is no array
+	instructionList, labels, err := parser.NewParser().Parse("ipush 1\nipush 0\nspush \"v\"\naset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := interpreter.NewInterpreter(instructionList, labels)
+	if err := vm.Run(); err == nil {
+		t.Fatal("expected aset on an int to fail")
+	}
+	if stack := vm.Stack(); len(stack) != 3 || stack[0].ToHuman() != "1" || stack[2].ToHuman() != "v" {
+		t.Errorf("expected the operands of aset back on the stack and got %v", stack)
+	}
+}
+
+func TestStackLimits(t *testing.T) {
+	if err := run(t, "ipush 1\nadd"); !errors.Is(err, interpreter.ErrStackUnderflow) {
+		t.Errorf("expected stack underflow and got %v", err)
+	}
+
+	if err := run(t, "drop"); !errors.Is(err, interpreter.ErrStackUnderflow) {
+		t.Errorf("expected stack underflow and got %v", err)
+	}
+
+	if err := run(t, "ipush 1\ndup\ndup", interpreter.WithMaxStackDepth(2)); !errors.Is(err, interpreter.ErrStackOverflow) {
+		t.Errorf("expected stack overflow and got %v", err)
+	}
+
+	if err := run(t, "ipush 1\ndup\nadd", interpreter.WithMaxStackDepth(2)); err != nil {
+		t.Errorf("expected no error and got %v", err)
+	}
+}
+
+func TestResumableExecution(t *testing.T) {
+	source := "ipush 0\nloop:\nipush 1\nadd\ndup\nstore counter\ndup\nipush 5\nlt\ncjmp loop end\nend:\ncall proc\njmp done\nproc:\ngoto $\ndone:"
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := interpreter.NewInterpreter(instructionList, labels)
+
+	if err := vm.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if vm.PC() != 1 || len(vm.Stack()) != 1 {
+		t.Fatalf("expected one executed instruction, pc is %v and stack %v", vm.PC(), vm.Stack())
+	}
+
+	if err := vm.RunFor(9); err != nil {
+		t.Fatal(err)
+	}
+	if vm.PC() != 1 || vm.Storage()["counter"].ToHuman() != "1" {
+		t.Fatalf("expected to be back at the loop after one iteration, pc is %v and storage %v", vm.PC(), vm.Storage())
+	}
+
+	for !vm.Halted() && len(vm.ReferenceStack()) == 0 {
+		if err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if references := vm.ReferenceStack(); len(references) != 1 || references[0] != (*labels)["end"]+2 {
+		t.Fatalf("expected a pending call, got %v", references)
+	}
+
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !vm.Halted() || vm.Storage()["counter"].ToHuman() != "5" || len(vm.Stack()) != 1 {
+		t.Errorf("unexpected final state, stack %v and storage %v", vm.Stack(), vm.Storage())
+	}
+
+	if err := vm.Step(); err != nil || !vm.Halted() {
+		t.Errorf("stepping a halted interpreter must do nothing")
+	}
+}
+
+func TestGas(t *testing.T) {
+	loop := "loop:\njmp loop"
+
+	instructionList, labels, err := parser.NewParser().Parse(loop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := interpreter.NewInterpreter(instructionList, labels, interpreter.WithGasLimit(100))
+	if err := vm.Run(); !errors.Is(err, interpreter.ErrOutOfGas) {
+		t.Fatalf("expected ErrOutOfGas and got %v", err)
+	}
+	if vm.GasUsed() != 100 {
+		t.Errorf("expected 100 gas to be used and got %v", vm.GasUsed())
+	}
+
+	costs := map[int]int{instructions.INS_JMP: 10, instructions.INS_VOID: 0}
+	vm = interpreter.NewInterpreter(instructionList, labels, interpreter.WithGasLimit(95), interpreter.WithGasCosts(costs))
+	if err := vm.Run(); !errors.Is(err, interpreter.ErrOutOfGas) || vm.GasUsed() != 90 {
+		t.Errorf("expected to run out of gas after 90 and got %v with %v used", err, vm.GasUsed())
+	}
+
+	instructionList, labels, err = parser.NewParser().Parse("ipush 1\nipush 2\nadd\ndrop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm = interpreter.NewInterpreter(instructionList, labels)
+	if err := vm.Run(); err != nil || vm.GasUsed() != 4 {
+		t.Errorf("expected 4 gas to be used and got %v with %v", vm.GasUsed(), err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a negative gas cost to panic")
+		}
+	}()
+	interpreter.WithGasCosts(map[int]int{instructions.INS_JMP: -1})
+}
+
+func TestRunContext(t *testing.T) {
+	instructionList, labels, err := parser.NewParser().Parse("loop:\njmp loop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	vm := interpreter.NewInterpreter(instructionList, labels)
+	if err := vm.RunContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to stop the program and got %v", err)
+	}
+
+	instructionList, labels, err = parser.NewParser().Parse("ipush 1\ndrop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm = interpreter.NewInterpreter(instructionList, labels)
+	if err := vm.RunContext(context.Background()); err != nil || !vm.Halted() {
+		t.Errorf("expected the program to finish and got %v", err)
+	}
+}
+
+func TestInput(t *testing.T) {
+	source := `readint
+ipush 1
+add
+println
+loop:
+eof
+cjmp end line
+line:
+readln
+println
+jmp loop
+end:
+readln`
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	vm := interpreter.NewInterpreter(instructionList, labels, interpreter.WithStdout(&output), interpreter.WithStdin(strings.NewReader(" 41\r\nfirst\nlast")))
+	if err := vm.Run(); !errors.Is(err, interpreter.ErrEndOfInput) {
+		t.Errorf("expected ErrEndOfInput and got %v", err)
+	}
+
+	if output.String() != "42\nfirst\nlast\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+
+	instructionList, labels, err = parser.NewParser().Parse("readln\nreadall\nreadall\nreadint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm = interpreter.NewInterpreter(instructionList, labels, interpreter.WithStdin(strings.NewReader("a\nb\nc\n")))
+	if err := vm.Run(); !errors.Is(err, interpreter.ErrEndOfInput) {
+		t.Errorf("expected ErrEndOfInput and got %v", err)
+	}
+	if stack := vm.Stack(); len(stack) != 3 || stack[1].ToHuman() != "b\nc\n" || stack[2].ToHuman() != "" {
+		t.Errorf("unexpected stack %v", stack)
+	}
+}
+
+func TestCallFrames(t *testing.T) {
+	source := `ipush 1
+store x
+ipush 10
+ipush 20
+call proc
+jmp end
+proc:
+arg 1
+local x
+arg 0
+load x
+add
+store x
+load x
+store result
+ret
+end:`
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := interpreter.NewInterpreter(instructionList, labels)
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := vm.Storage()
+	if storage["x"].ToHuman() != "1" || storage["result"].ToHuman() != "30" {
+		t.Errorf("expected the local x to shadow the global one, got %v", storage)
+	}
+	if vm.Locals() != nil {
+		t.Errorf("expected the locals to be gone after ret")
+	}
+
+	if err := run(t, "loop:\ncall loop", interpreter.WithMaxCallDepth(100)); !errors.Is(err, interpreter.ErrCallStackOverflow) {
+		t.Errorf("expected a call stack overflow and got %v", err)
+	}
+
+	if err := run(t, "ret"); err == nil {
+		t.Errorf("expected ret without a call to fail")
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	source := `ipush 1
+try handler
+ipush 2
+ipush 3
+call proc
+endtry
+handler:
+store caught
+try thrown
+spush "a"
+ipush 5
+sub
+thrown:
+store message
+ipush 42
+throw
+proc:
+ipush 4
+spush "boom"
+throw`
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := interpreter.NewInterpreter(instructionList, labels)
+	err = vm.Run()
+
+	var exception *interpreter.Exception
+	if !errors.As(err, &exception) || exception.Value.ToHuman() != "42" {
+		t.Fatalf("expected the uncaught exception 42 and got %v", err)
+	}
+	var runtimeErr *interpreter.RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.OpCode != instructions.INS_THROW {
+		t.Errorf("expected uncaught exceptions to be runtime errors, got %v", err)
+	}
+
+	storage := vm.Storage()
+	if storage["caught"].ToHuman() != "boom" {
+		t.Errorf("expected the thrown value to be caught, got %v", storage["caught"])
+	}
+	if !strings.Contains(storage["message"].ToHuman(), "can't remove 5 characters") {
+		t.Errorf("expected the runtime error message to be caught, got %v", storage["message"])
+	}
+	if stack := vm.Stack(); len(stack) != 2 || stack[0].ToHuman() != "1" || len(vm.ReferenceStack()) != 0 {
+		t.Errorf("expected the stack and frames to be unwound, got %v and %v", stack, vm.ReferenceStack())
+	}
+
+	// the protected code drops below the stack depth of the try, the handler
+	// must only see the thrown value and not the operand of throw as well
+	var output bytes.Buffer
+	err = run(t, "ipush 1\nipush 2\ntry handler\ndrop\ndrop\nspush \"boom\"\nthrow\nhandler:\nprintln\nprintln", interpreter.WithStdout(&output))
+	if output.String() != "boom\n" || !errors.As(err, &runtimeErr) || runtimeErr.OpCode != instructions.INS_PRINTLN {
+		t.Errorf("expected boom to be printed once before println fails, got %q and %v", output.String(), err)
+	}
+
+	if err := run(t, "try handler\nloop:\njmp loop\nhandler:", interpreter.WithGasLimit(50)); !errors.Is(err, interpreter.ErrOutOfGas) {
+		t.Errorf("expected running out of gas not to be catchable, got %v", err)
+	}
+}
+
+// TestSuperinstructions runs programs with and without superinstructions and
+// expects the same results, errors and gas consumption.
+func TestSuperinstructions(t *testing.T) {
+	testCases := []struct {
+		source  string
+		options []interpreter.Option
+	}{
+		{counting, nil},
+		{counting, []interpreter.Option{interpreter.WithGasLimit(51)}},
+		{counting, []interpreter.Option{interpreter.WithGasLimit(53)}},
+		{counting, []interpreter.Option{interpreter.WithMaxStackDepth(1)}},
+		{counting, []interpreter.Option{interpreter.WithGasCosts(map[int]int{instructions.INS_ADD: 5})}},
+		{"spush \"a\"\nstore x\nload x\nipush 1\nadd\nstore x", nil},
+		{"load missing\nipush 1\nadd\nstore missing", nil},
+		{"fpush 1.5\nipush 2\nlt\ncjmp a b\na:\nspush \"a\"\nb:", nil},
+		{"ipush 2\nipush 2\ncmp\ncjmp a b\na:\nspush \"a\"\nb:", nil},
+		{"ipush 3\nlt\ncjmp a a\na:", nil},
+		{"ipush 1\nstore x\ncall proc\njmp end\nproc:\nipush 5\nlocal x\nload x\nipush -2\nadd\nstore x\nload x\nret\nend:\nload x", nil},
+	}
+
+	for _, testCase := range testCases {
+		instructionList, labels, err := parser.NewParser().Parse(testCase.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, steps := range []int{-1, 1, 7, 50} {
+			fused := interpreter.NewInterpreter(instructionList, labels, testCase.options...)
+			plain := interpreter.NewInterpreter(instructionList, labels, append(testCase.options, interpreter.WithoutSuperinstructions())...)
+
+			var fusedErr, plainErr error
+			if steps < 0 {
+				fusedErr, plainErr = fused.Run(), plain.Run()
+			} else {
+				fusedErr, plainErr = fused.RunFor(steps), plain.RunFor(steps)
+			}
+
+			if fmt.Sprint(fusedErr) != fmt.Sprint(plainErr) {
+				t.Errorf("%q: expected error %v and got %v", testCase.source, plainErr, fusedErr)
+			}
+			if fused.PC() != plain.PC() || fused.GasUsed() != plain.GasUsed() {
+				t.Errorf("%q after %v steps: expected pc %v and gas %v, got %v and %v", testCase.source, steps, plain.PC(), plain.GasUsed(), fused.PC(), fused.GasUsed())
+			}
+			if !reflect.DeepEqual(fused.Stack(), plain.Stack()) || !reflect.DeepEqual(fused.Storage(), plain.Storage()) {
+				t.Errorf("%q after %v steps: expected %v %v and got %v %v", testCase.source, steps, plain.Stack(), plain.Storage(), fused.Stack(), fused.Storage())
+			}
+		}
+	}
+}
+
+// TestMalformedInstructions makes sure instructions with missing or wrong
+// params only fail once they are executed, like they did before decoding.
+func TestMalformedInstructions(t *testing.T) {
+	instructionList := []instructions.Instruction{
+		{OpCode: instructions.INS_IPUSH, Params: []interface{}{1}},
+		{OpCode: instructions.INS_JMP, Params: []interface{}{3}},
+		{OpCode: instructions.INS_IPUSH, Params: []interface{}{"one"}},
+		{OpCode: instructions.INS_CALL},
+	}
+
+	vm := interpreter.NewInterpreter(instructionList, nil)
+	err := vm.Run()
+
+	var runtimeErr *interpreter.RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Instruction != 3 || !strings.Contains(err.Error(), "call requires 1 parameters and got 0") {
+		t.Fatalf("expected the call to fail and got %v", err)
+	}
+	if len(vm.Stack()) != 1 || vm.GasUsed() != 3 {
+		t.Errorf("expected the instructions before the call to run, got stack %v and %v gas", vm.Stack(), vm.GasUsed())
+	}
+}
+
+// execute runs source and returns the stack it leaves behind, formatted like
+// types.Format with the head last, and the error it failed with.
+func execute(t *testing.T, source string) (string, error) {
+	t.Helper()
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := interpreter.NewInterpreter(instructionList, labels)
+	err = vm.Run()
+
+	var formatted []string
+	for _, object := range vm.Stack() {
+		formatted = append(formatted, types.Format(object))
+	}
+	return strings.Join(formatted, " "), err
+}
+
+func TestArrays(t *testing.T) {
+	testCases := []struct {
+		source string
+		stack  string
+		err    string
+	}{
+		{"anew\nipush 1\napush\nspush \"a\"\napush", `[1, "a"]`, ""},
+		{"anew\nipush 1\napush\nipush 0\naget", "1", ""},
+		{"anew\nipush 1\napush\nipush 0\nipush 2\naset\nalen", "1", ""},
+		{"anew\nipush 1\napush\nipush 2\napush\nipush 3\napush\nipush 1\nipush 3\naslice", "[2, 3]", ""},
+		{"anew\nalen\nanew\nsizeof", "0 0", ""},
+		// failing instructions leave their operands on the stack
+		{"anew\nipush 0\naget", "[] 0", "index 0 out of range"},
+		{"anew\nspush \"a\"\naget", `[] "a"`, "can't index sick::array with sick::string"},
+		{"ipush 1\nipush 0\nipush 2\naset", "1 0 2", "can't index sick::int with sick::int"},
+		{"ipush 1\nipush 2\napush", "1 2", "apush requires a sick::array"},
+		{"anew\nipush 0\nspush \"b\"\naslice", `[] 0 "b"`, "aslice requires a sick::array and two sick::int"},
+		{"anew\nipush 1\nipush 0\naslice", "[] 1 0", "out of range"},
+		{"ipush 1\nalen", "1", "alen requires a sick::array"},
+	}
+
+	for _, testCase := range testCases {
+		stack, err := execute(t, testCase.source)
+		if testCase.err == "" && err != nil || testCase.err != "" && (err == nil || !strings.Contains(err.Error(), testCase.err)) {
+			t.Errorf("%q: expected error %q and got %v", testCase.source, testCase.err, err)
+		}
+		if stack != testCase.stack {
+			t.Errorf("%q: expected stack %v and got %v", testCase.source, testCase.stack, stack)
+		}
+	}
+}
+
+func TestMaps(t *testing.T) {
+	testCases := []struct {
+		source string
+		stack  string
+		err    string
+	}{
+		{"mnew\nspush \"a\"\nipush 1\nmput\nspush \"a\"\nipush 0\nmget", "1", ""},
+		{"mnew\nspush \"a\"\nipush 0\nmget", "0", ""},
+		{"mnew\nipush 1\nbpush true\nmput\ndup\nipush 1\nmhas\nswap\nipush 2\nmhas", "true false", ""},
+		{"mnew\nspush \"b\"\nipush 2\nmput\nspush \"a\"\nipush 1\nmput\nmkeys", `["b", "a"]`, ""},
+		{"mnew\nspush \"a\"\nipush 1\nmput\nspush \"a\"\nmdel\nmlen", "0", ""},
+		{"mnew\nspush \"a\"\nipush 1\nmput\nsizeof", "1", ""},
+		// failing instructions leave their operands on the stack
+		{"ipush 1\nspush \"a\"\nipush 2\nmput", `1 "a" 2`, "mput requires a sick::map and got sick::int"},
+		{"mnew\nanew\nipush 1\nmput", "{} [] 1", "sick::array"},
+		{"ipush 1\nspush \"a\"\nipush 0\nmget", `1 "a" 0`, "mget requires a sick::map and got sick::int"},
+		{"mnew\nanew\nipush 0\nmget", "{} [] 0", "sick::array"},
+		{"ipush 1\nspush \"a\"\nmhas", `1 "a"`, "mhas requires a sick::map and got sick::int"},
+		{"ipush 1\nspush \"a\"\nmdel", `1 "a"`, "mdel requires a sick::map and got sick::int"},
+		{"ipush 1\nmkeys", "1", "mkeys requires a sick::map and got sick::int"},
+		{"ipush 1\nmlen", "1", "mlen requires a sick::map and got sick::int"},
+	}
+
+	for _, testCase := range testCases {
+		stack, err := execute(t, testCase.source)
+		if testCase.err == "" && err != nil || testCase.err != "" && (err == nil || !strings.Contains(err.Error(), testCase.err)) {
+			t.Errorf("%q: expected error %q and got %v", testCase.source, testCase.err, err)
+		}
+		if stack != testCase.stack {
+			t.Errorf("%q: expected stack %v and got %v", testCase.source, testCase.stack, stack)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// NativeFunction is a Go function that sick programs can invoke. It receives
+// its arguments in the order they were pushed and its results are pushed in
+// the order they are returned.
+type NativeFunction func(interpreter *Interpreter, args []types.SickObject) ([]types.SickObject, error)
+
+type native struct {
+	arity    int
+	function NativeFunction
+}
+
+// RegisterNative makes function available to the native instruction and to
+// call, if no label with the same name exists. function is invoked with
+// exactly arity arguments taken from the stack.
+func (interpreter *Interpreter) RegisterNative(name string, arity int, function NativeFunction) {
+	if arity < 0 {
+		panic(fmt.Sprintf("interpreter: negative arity %v for native %v", arity, name))
+	}
+
+	if interpreter.natives == nil {
+		interpreter.natives = make(map[string]native)
+	}
+	interpreter.natives[name] = native{arity, function}
+}
+
+// callNative pops the arguments of the named native, invokes it and pushes its results.
+func (interpreter *Interpreter) callNative(name string) error {
+	native, ok := interpreter.natives[name]
+	if !ok {
+		return fmt.Errorf("undefined native %v", name)
+	}
+
+	depth := len(interpreter.objectStack)
+	if depth < native.arity {
+		return fmt.Errorf("%w: native %v needs %v, have %v", ErrStackUnderflow, name, native.arity, depth)
+	}
+
+	args := make([]types.SickObject, native.arity)
+	copy(args, interpreter.objectStack[depth-native.arity:])
+
+	results, err := native.function(interpreter, args)
+	if err != nil {
+		return fmt.Errorf("native %v: %w", name, err)
+	}
+
+	for _, result := range results {
+		if result == nil {
+			return fmt.Errorf("native %v returned nil", name)
+		}
+	}
+
+	if interpreter.maxStackDepth > 0 && depth-native.arity+len(results) > interpreter.maxStackDepth {
+		return fmt.Errorf("%w: native %v returned %v results, have %v of %v", ErrStackOverflow, name, len(results), depth-native.arity, interpreter.maxStackDepth)
+	}
+
+	interpreter.objectStack = interpreter.objectStack[:depth-native.arity]
+	for _, result := range results {
+		interpreter.objectStack.Push(result)
+	}
+	return nil
+}
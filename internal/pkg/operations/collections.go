@@ -0,0 +1,89 @@
+package operations
+
+import (
+	"fmt"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// Collection executes the instructions on arrays and maps, which all push a
+// single result. operands holds what the instruction pops, the deepest first.
+func Collection(opCode int, operands []types.SickObject) (types.SickObject, error) {
+	switch opCode {
+	case instructions.INS_ANEW:
+		return types.NewSickArray(), nil
+	case instructions.INS_AGET:
+		array, position, err := asArrayAndIndex(operands[0], operands[1])
+		if err != nil {
+			return nil, err
+		}
+		return array.Get(position)
+	case instructions.INS_ASET:
+		array, position, err := asArrayAndIndex(operands[0], operands[1])
+		if err != nil {
+			return nil, err
+		}
+		return array, array.Set(position, operands[2])
+	case instructions.INS_APUSH:
+		array, ok := operands[0].(*types.SickArray)
+		if !ok {
+			return nil, fmt.Errorf("apush requires a %v", (*types.SickArray)(nil).TypeName())
+		}
+		array.Append(operands[1])
+		return array, nil
+	case instructions.INS_ASLICE:
+		array, arrayOk := operands[0].(*types.SickArray)
+		start, startOk := operands[1].(types.SickInt)
+		end, endOk := operands[2].(types.SickInt)
+		if !arrayOk || !startOk || !endOk {
+			return nil, fmt.Errorf("aslice requires a %v and two %v", (*types.SickArray)(nil).TypeName(), types.SickInt{}.TypeName())
+		}
+		return array.Slice(start.Value, end.Value)
+	case instructions.INS_ALEN:
+		array, ok := operands[0].(*types.SickArray)
+		if !ok {
+			return nil, fmt.Errorf("alen requires a %v", (*types.SickArray)(nil).TypeName())
+		}
+		return types.SickInt{Value: array.Len()}, nil
+	case instructions.INS_MNEW:
+		return types.NewSickMap(), nil
+	}
+
+	sickMap, ok := operands[0].(*types.SickMap)
+	if !ok {
+		return nil, fmt.Errorf("%v requires a %v and got %v", instructions.Mnemonic(opCode), (*types.SickMap)(nil).TypeName(), operands[0].TypeName())
+	}
+
+	switch opCode {
+	case instructions.INS_MPUT:
+		return sickMap, sickMap.Put(operands[1], operands[2])
+	case instructions.INS_MGET:
+		value, ok, err := sickMap.Get(operands[1])
+		if !ok {
+			value = operands[2]
+		}
+		return value, err
+	case instructions.INS_MHAS:
+		_, ok, err := sickMap.Get(operands[1])
+		return types.SickBool{Value: ok}, err
+	case instructions.INS_MDEL:
+		return sickMap, sickMap.Delete(operands[1])
+	case instructions.INS_MKEYS:
+		return sickMap.Keys(), nil
+	case instructions.INS_MLEN:
+		return types.SickInt{Value: sickMap.Len()}, nil
+	}
+
+	return nil, fmt.Errorf("no handling for instruction: %v", opCode)
+}
+
+func asArrayAndIndex(array types.SickObject, index types.SickObject) (*types.SickArray, int, error) {
+	sickArray, arrayOk := array.(*types.SickArray)
+	sickInt, indexOk := index.(types.SickInt)
+	if !arrayOk || !indexOk {
+		return nil, 0, fmt.Errorf("can't index %v with %v", array.TypeName(), index.TypeName())
+	}
+
+	return sickArray, sickInt.Value, nil
+}
@@ -0,0 +1,68 @@
+package operations
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// ErrEndOfInput is returned when readln or readint find no more input.
+var ErrEndOfInput = errors.New("end of input")
+
+// Read executes readln, readint, readall and eof on stdin.
+func Read(opCode int, stdin *bufio.Reader) (types.SickObject, error) {
+	switch opCode {
+	case instructions.INS_READLN:
+		line, err := readLine(stdin)
+		if err != nil {
+			return nil, err
+		}
+		return types.SickString{Value: line}, nil
+	case instructions.INS_READINT:
+		line, err := readLine(stdin)
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil {
+			return nil, fmt.Errorf("can't read %q as %v", line, types.SickInt{}.TypeName())
+		}
+		return types.SickInt{Value: value}, nil
+	case instructions.INS_READALL:
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		return types.SickString{Value: string(content)}, nil
+	case instructions.INS_EOF:
+		_, err := stdin.Peek(1)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return types.SickBool{Value: err == io.EOF}, nil
+	}
+
+	return nil, fmt.Errorf("no handling for instruction: %v", opCode)
+}
+
+// readLine reads the next line of input without its line break. A last line
+// without line break is returned as well, only reading past it fails.
+func readLine(stdin *bufio.Reader) (string, error) {
+	line, err := stdin.ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return "", ErrEndOfInput
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
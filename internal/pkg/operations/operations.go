@@ -0,0 +1,129 @@
+// Package operations implements what instructions do with their operands.
+// The interpreter and the register machine only differ in where they take
+// operands from and where they put results, both call these functions so
+// they compute the same values and fail with the same errors.
+package operations
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+var arithmeticOperators = map[int]string{
+	instructions.INS_MUL: "*",
+	instructions.INS_DIV: "/",
+	instructions.INS_MOD: "%",
+}
+
+var comparisonOperators = map[int]string{
+	instructions.INS_LT:  "<",
+	instructions.INS_GT:  ">",
+	instructions.INS_LTE: "<=",
+	instructions.INS_GTE: ">=",
+}
+
+// Binary computes add, sub, mul, div, mod, cmp, lt, gt, lte and gte. left
+// is the deeper operand on the stack, right the head.
+func Binary(opCode int, left types.SickObject, right types.SickObject) (types.SickObject, error) {
+	switch opCode {
+	case instructions.INS_ADD:
+		addable, ok := right.(types.Addable)
+		if !ok {
+			return nil, fmt.Errorf("can't do %v + %v", left.TypeName(), right.TypeName())
+		}
+		return addable.Add(left)
+	case instructions.INS_SUB:
+		if str, ok := left.(types.SickString); ok {
+			return removeCharacters(str, right)
+		}
+		return types.Arithmetic("-", left, right)
+	case instructions.INS_MUL, instructions.INS_DIV, instructions.INS_MOD:
+		return types.Arithmetic(arithmeticOperators[opCode], left, right)
+	case instructions.INS_CMP:
+		return types.SickBool{Value: types.Equal(left, right)}, nil
+	case instructions.INS_LT, instructions.INS_GT, instructions.INS_LTE, instructions.INS_GTE:
+		leftNum, leftOk := left.(types.SickNum)
+		rightNum, rightOk := right.(types.SickNum)
+		if !leftOk || !rightOk {
+			return nil, fmt.Errorf("can't do %v %v %v", left.TypeName(), comparisonOperators[opCode], right.TypeName())
+		}
+
+		comparison := types.Compare(leftNum, rightNum)
+		switch opCode {
+		case instructions.INS_LT:
+			return types.SickBool{Value: comparison < 0}, nil
+		case instructions.INS_GT:
+			return types.SickBool{Value: comparison > 0}, nil
+		case instructions.INS_LTE:
+			return types.SickBool{Value: comparison <= 0}, nil
+		default:
+			return types.SickBool{Value: comparison >= 0}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no handling for instruction: %v", opCode)
+}
+
+// removeCharacters implements sub on a string, which removes count
+// characters from its end.
+func removeCharacters(str types.SickString, count types.SickObject) (types.SickObject, error) {
+	n, ok := count.(types.SickInt)
+	if !ok {
+		return nil, fmt.Errorf("can't invoke Sub-Instruction with [%v(%v) - %v(%v)]", str.ToHuman(), str.TypeName(), count.ToHuman(), count.TypeName())
+	}
+	if n.Value < 0 || n.Value > len(str.Value) {
+		return nil, fmt.Errorf("can't remove %v characters from a string of size %v", n.Value, len(str.Value))
+	}
+	return types.SickString{Value: str.Value[:len(str.Value)-n.Value]}, nil
+}
+
+// Require fails unless value has the type called typeName, like req does.
+func Require(value types.SickObject, typeName string) error {
+	if actual := value.TypeName(); actual != typeName {
+		return fmt.Errorf("required type %v and got %v", typeName, actual)
+	}
+	return nil
+}
+
+// Condition returns whether cjmp jumps to its first target.
+func Condition(value types.SickObject) (bool, error) {
+	condition, ok := value.(types.SickBool)
+	if !ok {
+		return false, fmt.Errorf("cjmp requires a %v condition", types.SickBool{}.TypeName())
+	}
+	return condition.Value, nil
+}
+
+// Sizeof returns the length of a string, array or map.
+func Sizeof(value types.SickObject) (types.SickObject, error) {
+	switch value := value.(type) {
+	case types.SickString:
+		return types.SickInt{Value: len(value.Value)}, nil
+	case *types.SickArray:
+		return types.SickInt{Value: value.Len()}, nil
+	case *types.SickMap:
+		return types.SickInt{Value: value.Len()}, nil
+	}
+	return nil, fmt.Errorf("can't use sizeof on %v", value.TypeName())
+}
+
+// Dump writes stack the way the dump instruction shows it, the head being the last element.
+func Dump(w io.Writer, stack []types.SickObject) error {
+	var dump strings.Builder
+	fmt.Fprintf(&dump, "=== SickObjectStack Dump ===\n")
+	for i := len(stack); i > 0; i-- {
+		var anno string
+		if len(stack) == i {
+			anno = "   <-- head"
+		}
+		fmt.Fprintf(&dump, "%v: %v%v\n", i, stack[i-1].ToHuman(), anno)
+	}
+	fmt.Fprintf(&dump, "==================\n")
+
+	_, err := io.WriteString(w, dump.String())
+	return err
+}
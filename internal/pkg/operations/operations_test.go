@@ -0,0 +1,44 @@
+package operations_test
+
+import (
+	"strings"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/operations"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+func TestBinary(t *testing.T) {
+	testCases := []struct {
+		opCode   int
+		left     types.SickObject
+		right    types.SickObject
+		expected string
+		err      string
+	}{
+		{instructions.INS_ADD, types.SickString{Value: "a"}, types.SickString{Value: "b"}, `"ab"`, ""},
+		{instructions.INS_SUB, types.SickInt{Value: 5}, types.SickInt{Value: 3}, "2", ""},
+		{instructions.INS_SUB, types.SickString{Value: "abc"}, types.SickInt{Value: 1}, `"ab"`, ""},
+		{instructions.INS_SUB, types.SickString{Value: "abc"}, types.SickInt{Value: 4}, "", "can't remove 4 characters from a string of size 3"},
+		{instructions.INS_DIV, types.SickInt{Value: 7}, types.SickInt{Value: 2}, "3", ""},
+		{instructions.INS_LT, types.SickInt{Value: 1}, types.SickFloat{Value: 1.5}, "true", ""},
+		{instructions.INS_GTE, types.SickInt{Value: 1}, types.SickBool{Value: true}, "", "can't do sick::int >= sick::bool"},
+		{instructions.INS_CMP, types.SickInt{Value: 1}, types.SickFloat{Value: 1}, "true", ""},
+		{instructions.INS_DUP, types.SickInt{Value: 1}, types.SickInt{Value: 1}, "", "no handling for instruction"},
+	}
+
+	for _, testCase := range testCases {
+		result, err := operations.Binary(testCase.opCode, testCase.left, testCase.right)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("%v %v %v: expected error %q and got %v", testCase.left, instructions.Mnemonic(testCase.opCode), testCase.right, testCase.err, err)
+			}
+			continue
+		}
+
+		if err != nil || types.Format(result) != testCase.expected {
+			t.Errorf("%v %v %v: expected %v and got %v (%v)", testCase.left, instructions.Mnemonic(testCase.opCode), testCase.right, testCase.expected, result, err)
+		}
+	}
+}
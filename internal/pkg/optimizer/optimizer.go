@@ -0,0 +1,314 @@
+// Package optimizer rewrites programs into equivalent ones that execute
+// fewer instructions.
+package optimizer
+
+import (
+	"math"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/types"
+	"mvmo.dev/sickvm/internal/pkg/verify"
+)
+
+type optimizer struct {
+	instructions []instructions.Instruction
+	labels       map[string]int
+	removed      []bool
+}
+
+// Optimize returns a copy of the program with label placeholders and other
+// instructions without effect removed, constant expressions folded and jumps
+// to jumps threaded. Jump targets and labels are moved along with the
+// instructions they point to. The optimized program produces the same output,
+// but consumes less gas and can fail with a different stack on errors.
+func Optimize(instructionList []instructions.Instruction, labels *map[string]int) ([]instructions.Instruction, *map[string]int) {
+	optimizer := &optimizer{
+		instructions: append([]instructions.Instruction(nil), instructionList...),
+		labels:       map[string]int{},
+	}
+	if labels != nil {
+		for name, index := range *labels {
+			optimizer.labels[name] = index
+		}
+	}
+
+	for changed := true; changed; {
+		changed = optimizer.threadJumps()
+
+		optimizer.removed = make([]bool, len(optimizer.instructions))
+		optimizer.removeNoOps()
+		optimizer.peephole()
+		changed = optimizer.compact() || changed
+	}
+
+	return optimizer.instructions, &optimizer.labels
+}
+
+// threadJumps makes jumps that lead to an unconditional jump go to its target directly.
+func (optimizer *optimizer) threadJumps() bool {
+	changed := false
+	for i, instruction := range optimizer.instructions {
+		if !instructions.IsJump(instruction.OpCode) {
+			continue
+		}
+
+		var params []interface{}
+		for j, param := range instruction.Params {
+			target := optimizer.finalTarget(param.(int))
+			if target == param.(int) {
+				continue
+			}
+
+			if params == nil {
+				params = append([]interface{}(nil), instruction.Params...)
+			}
+			params[j] = target
+		}
+
+		if params != nil {
+			optimizer.instructions[i].Params = params
+			changed = true
+		}
+	}
+	return changed
+}
+
+// finalTarget follows the chain of jumps starting at target to the first
+// instruction that isn't one. Jumps in a cycle are left as they are.
+func (optimizer *optimizer) finalTarget(target int) int {
+	visited := map[int]bool{}
+	for target >= 0 && target < len(optimizer.instructions) && !visited[target] {
+		visited[target] = true
+
+		instruction := optimizer.instructions[target]
+		switch {
+		case instruction.OpCode == instructions.INS_VOID:
+			target++
+		case instruction.OpCode == instructions.INS_JMP:
+			target = instruction.Params[0].(int)
+		case instruction.OpCode == instructions.INS_GOTO && instruction.Params[0] != "$":
+			next, ok := optimizer.labels[instruction.Params[0].(string)]
+			if !ok {
+				return target
+			}
+			target = next
+		default:
+			return target
+		}
+	}
+	return target
+}
+
+// removeNoOps removes voids and jumps to the instruction following them.
+func (optimizer *optimizer) removeNoOps() {
+	for i, instruction := range optimizer.instructions {
+		if instruction.OpCode == instructions.INS_VOID {
+			optimizer.removed[i] = true
+		}
+	}
+
+	for i := len(optimizer.instructions) - 1; i >= 0; i-- {
+		instruction := optimizer.instructions[i]
+		if instruction.OpCode != instructions.INS_JMP || instruction.Params[0].(int) <= i {
+			continue
+		}
+
+		skipped := true
+		for j := i + 1; j < instruction.Params[0].(int) && j < len(optimizer.instructions); j++ {
+			skipped = skipped && optimizer.removed[j]
+		}
+		optimizer.removed[i] = skipped
+	}
+}
+
+// peephole rewrites short sequences of instructions. A sequence can't
+// contain instructions other code jumps to, except for its first one.
+func (optimizer *optimizer) peephole() {
+	leaders := optimizer.leaders()
+	depths := verify.StackDepths(optimizer.instructions, &optimizer.labels)
+
+	// window returns the indices of the n instructions starting at i that
+	// weren't removed yet, as long as control can only enter at the first.
+	window := func(i int, n int) ([]int, bool) {
+		var indices []int
+		for j := i; j < len(optimizer.instructions) && len(indices) < n; j++ {
+			if j != i && leaders[j] {
+				return nil, false
+			}
+			if optimizer.removed[j] {
+				continue
+			}
+			indices = append(indices, j)
+		}
+		return indices, len(indices) == n
+	}
+
+	for i := range optimizer.instructions {
+		if optimizer.removed[i] {
+			continue
+		}
+
+		if pair, ok := window(i, 2); ok && removesItself(optimizer.instructions[pair[0]], optimizer.instructions[pair[1]], depths[pair[0]]) {
+			optimizer.removed[pair[0]] = true
+			optimizer.removed[pair[1]] = true
+			continue
+		}
+
+		if triple, ok := window(i, 3); ok {
+			if folded, ok := fold(optimizer.instructions[triple[0]], optimizer.instructions[triple[1]], optimizer.instructions[triple[2]]); ok {
+				optimizer.instructions[triple[0]] = folded
+				optimizer.removed[triple[1]] = true
+				optimizer.removed[triple[2]] = true
+			}
+		}
+	}
+}
+
+// leaders marks the instructions control can reach other than from the
+// instruction before them.
+func (optimizer *optimizer) leaders() []bool {
+	leaders := make([]bool, len(optimizer.instructions)+1)
+	for _, index := range optimizer.labels {
+		if index >= 0 && index < len(leaders) {
+			leaders[index] = true
+		}
+	}
+
+	for _, instruction := range optimizer.instructions {
+		if !instructions.IsJump(instruction.OpCode) {
+			continue
+		}
+		for _, param := range instruction.Params {
+			if target := param.(int); target >= 0 && target < len(leaders) {
+				leaders[target] = true
+			}
+		}
+	}
+	return leaders
+}
+
+// removesItself reports whether the second instruction undoes the first.
+// depth is the known stack depth before the first instruction or -1, pairs
+// that would underflow are kept so the program still fails.
+func removesItself(first instructions.Instruction, second instructions.Instruction, depth int) bool {
+	switch {
+	case first.OpCode == instructions.INS_SWAP && second.OpCode == instructions.INS_SWAP:
+		return depth >= 2
+	case first.OpCode == instructions.INS_DUP && second.OpCode == instructions.INS_DROP:
+		return depth >= 1
+	case isConstant(first) && second.OpCode == instructions.INS_DROP:
+		return true
+	}
+	return false
+}
+
+func isConstant(instruction instructions.Instruction) bool {
+	switch instruction.OpCode {
+	case instructions.INS_IPUSH, instructions.INS_SPUSH, instructions.INS_BPUSH, instructions.INS_FPUSH:
+		return true
+	}
+	return false
+}
+
+// fold computes a binary operation on two constants at compile time. It
+// doesn't fold operations that would fail, so they still fail when run.
+func fold(first instructions.Instruction, second instructions.Instruction, operation instructions.Instruction) (instructions.Instruction, bool) {
+	if !isConstant(first) || !isConstant(second) {
+		return instructions.Instruction{}, false
+	}
+
+	left := types.AnyToSickObject(first.Params[0])
+	right := types.AnyToSickObject(second.Params[0])
+
+	var result types.SickObject
+	var err error
+	switch operation.OpCode {
+	case instructions.INS_ADD:
+		addable, ok := right.(types.Addable)
+		if !ok {
+			return instructions.Instruction{}, false
+		}
+		result, err = addable.Add(left)
+	case instructions.INS_SUB:
+		if _, ok := left.(types.SickString); ok {
+			return instructions.Instruction{}, false
+		}
+		result, err = types.Arithmetic("-", left, right)
+	case instructions.INS_MUL:
+		result, err = types.Arithmetic("*", left, right)
+	case instructions.INS_DIV:
+		result, err = types.Arithmetic("/", left, right)
+	case instructions.INS_MOD:
+		result, err = types.Arithmetic("%", left, right)
+	case instructions.INS_CMP:
+		result = types.SickBool{Value: types.Equal(left, right)}
+	default:
+		return instructions.Instruction{}, false
+	}
+	if err != nil {
+		return instructions.Instruction{}, false
+	}
+
+	folded := instructions.Instruction{Line: first.Line}
+	switch result := result.(type) {
+	case types.SickInt:
+		folded.OpCode, folded.Params = instructions.INS_IPUSH, []interface{}{result.Value}
+	case types.SickFloat:
+		// the source format has no literals for these
+		if math.IsNaN(result.Value) || math.IsInf(result.Value, 0) {
+			return instructions.Instruction{}, false
+		}
+		folded.OpCode, folded.Params = instructions.INS_FPUSH, []interface{}{result.Value}
+	case types.SickString:
+		folded.OpCode, folded.Params = instructions.INS_SPUSH, []interface{}{result.Value}
+	case types.SickBool:
+		folded.OpCode, folded.Params = instructions.INS_BPUSH, []interface{}{result.Value}
+	default:
+		return instructions.Instruction{}, false
+	}
+	return folded, true
+}
+
+// compact drops the removed instructions. Jump targets and labels pointing
+// to a removed instruction move to the next one that is kept.
+func (optimizer *optimizer) compact() bool {
+	newIndex := make([]int, len(optimizer.instructions)+1)
+	var kept []instructions.Instruction
+	for i, instruction := range optimizer.instructions {
+		newIndex[i] = len(kept)
+		if !optimizer.removed[i] {
+			kept = append(kept, instruction)
+		}
+	}
+	newIndex[len(optimizer.instructions)] = len(kept)
+
+	if len(kept) == len(optimizer.instructions) {
+		return false
+	}
+
+	relocate := func(index int) int {
+		if index < 0 || index >= len(newIndex) {
+			return index
+		}
+		return newIndex[index]
+	}
+
+	for i, instruction := range kept {
+		if !instructions.IsJump(instruction.OpCode) {
+			continue
+		}
+
+		params := make([]interface{}, len(instruction.Params))
+		for j, param := range instruction.Params {
+			params[j] = relocate(param.(int))
+		}
+		kept[i].Params = params
+	}
+
+	for name, index := range optimizer.labels {
+		optimizer.labels[name] = relocate(index)
+	}
+
+	optimizer.instructions = kept
+	return true
+}
@@ -0,0 +1,111 @@
+package optimizer_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/disassembler"
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/optimizer"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+)
+
+func parse(t *testing.T, source string) ([]instructions.Instruction, *map[string]int) {
+	t.Helper()
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return instructionList, labels
+}
+
+// run returns everything the program writes and how much gas it used.
+func run(t *testing.T, instructionList []instructions.Instruction, labels *map[string]int) (string, int) {
+	t.Helper()
+
+	var output bytes.Buffer
+	vm := interpreter.NewInterpreter(instructionList, labels, interpreter.WithStdout(&output), interpreter.WithStderr(&output), interpreter.WithStdin(strings.NewReader("")))
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return output.String(), vm.GasUsed()
+}
+
+func TestOptimize(t *testing.T) {
+	testCases := []struct {
+		source   string
+		expected string
+	}{
+		{"ipush 2\nipush 3\nadd\nprintln", "ipush 5\nprintln\n"},
+		{"ipush 1\nipush 2\nipush 3\nmul\nadd\nspush \" apples\"\nadd\nprintln", "spush \"7 apples\"\nprintln\n"},
+		{"fpush 1.5\nipush 2\nmul\nipush 3\ncmp\nprintln", "bpush true\nprintln\n"},
+		{"readint\nreadint\nswap\nswap\ndup\ndrop\nipush 1\ndrop\nadd\nprintln", "readint\nreadint\nadd\nprintln\n"},
+		// pairs that would underflow are kept so they still fail
+		{"readint\nswap\nswap\nprintln", "readint\nswap\nswap\nprintln\n"},
+		{"dup\ndrop", "dup\ndrop\n"},
+		{"call proc\njmp end\nproc:\nswap\nswap\nret\nend:", "call proc\njmp end\nproc:\nswap\nswap\nret\nend:\n"},
+		{"call proc\njmp end\nproc:\nipush 1\ndup\ndrop\nret\nend:", "call proc\njmp end\nproc:\nipush 1\nret\nend:\n"},
+		// jumps to jumps and to the next instruction
+		{"bpush true\ncjmp a b\na:\njmp c\nb:\nipush 1\nc:\nprintln", "bpush true\ncjmp c b\na:\njmp c\nb:\nipush 1\nc:\nprintln\n"},
+		{"jmp a\na:\nspush \"x\"\nprintln", "a:\nspush \"x\"\nprintln\n"},
+		// failing operations are kept so they fail at runtime
+		{"ipush 1\nipush 0\ndiv", "ipush 1\nipush 0\ndiv\n"},
+		{"spush \"a\"\nbpush true\nmul", "spush \"a\"\nbpush true\nmul\n"},
+		// code other instructions jump into isn't merged
+		{"ipush 1\nloop:\nipush 2\nadd\njmp loop", "ipush 1\nloop:\nipush 2\nadd\njmp loop\n"},
+	}
+
+	for _, testCase := range testCases {
+		instructionList, labels := parse(t, testCase.source)
+		optimized, optimizedLabels := optimizer.Optimize(instructionList, labels)
+
+		var buffer bytes.Buffer
+		if err := disassembler.Disassemble(&buffer, optimized, optimizedLabels); err != nil {
+			t.Fatal(err)
+		}
+
+		if buffer.String() != testCase.expected {
+			t.Errorf("%q: expected\n%v\nand got\n%v", testCase.source, testCase.expected, buffer.String())
+		}
+	}
+}
+
+func TestOptimizeKeepsInput(t *testing.T) {
+	instructionList, labels := parse(t, "a:\nipush 2\nipush 3\nadd\njmp a")
+	optimizer.Optimize(instructionList, labels)
+
+	if len(instructionList) != 5 || instructionList[1].Params[0] != 2 || (*labels)["a"] != 0 {
+		t.Errorf("the program passed to Optimize was modified")
+	}
+}
+
+func TestOptimizeExamples(t *testing.T) {
+	files, err := filepath.Glob("../../../examples/*.sickc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		instructionList, labels := parse(t, string(content))
+		expected, gas := run(t, instructionList, labels)
+		optimized, optimizedLabels := optimizer.Optimize(instructionList, labels)
+		output, optimizedGas := run(t, optimized, optimizedLabels)
+
+		if output != expected {
+			t.Errorf("%v: optimized program wrote\n%v\ninstead of\n%v", file, output, expected)
+		}
+		if optimizedGas > gas {
+			t.Errorf("%v: optimized program used %v gas, more than %v without optimization", file, optimizedGas, gas)
+		}
+	}
+}
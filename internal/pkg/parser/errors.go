@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes a single problem found in the parsed source.
+// Line and Column are 1-based, File is empty when the input didn't come from a file.
+type ParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Token   string
+	Message string
+}
+
+func (err ParseError) Error() string {
+	file := err.File
+	if file == "" {
+		file = "<input>"
+	}
+
+	return fmt.Sprintf("%v:%v:%v: %v", file, err.Line, err.Column, err.Message)
+}
+
+// ParseErrors is returned by the parser and holds every problem of a single run.
+type ParseErrors []ParseError
+
+func (errs ParseErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
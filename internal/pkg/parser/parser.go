@@ -2,258 +2,226 @@ package parser
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
-	"syscall"
 
 	"mvmo.dev/sickvm/internal/pkg/instructions"
 )
 
+// paramParser turns a single textual parameter into the value stored in
+// instructions.Instruction.Params.
+type paramParser func(string) (interface{}, error)
+
 type Parser struct {
-	paramsParseFunctionsMap map[int][]interface{}
+	paramsParseFunctionsMap map[int][]paramParser
+}
+
+// labelReference remembers a jump parameter that names a label so it can be
+// resolved once every label of the input is known.
+type labelReference struct {
+	instruction int
+	param       int
+	token       token
 }
 
+// Parse parses input that doesn't originate from a file. See ParseFile.
 func (parser Parser) Parse(input string) ([]instructions.Instruction, *map[string]int, error) {
+	return parser.ParseFile("", input)
+}
+
+// ParseFile parses the source of the named file. Parsing doesn't stop at the
+// first problem, instead every problem found is returned as ParseErrors.
+func (parser Parser) ParseFile(file string, input string) ([]instructions.Instruction, *map[string]int, error) {
 	var returnValue []instructions.Instruction
 	var labels map[string]int = make(map[string]int)
-
-	rawLines := strings.Split(input, "\n")
-
-	var lines []string
-	for _, line := range rawLines {
-		if strings.HasPrefix(line, ";") {
-			continue
-		}
-		lines = append(lines, line)
+	var references []labelReference
+	var errs ParseErrors
+
+	fail := func(tok token, format string, args ...interface{}) {
+		errs = append(errs, ParseError{
+			File:    file,
+			Line:    tok.line,
+			Column:  tok.column,
+			Token:   tok.text,
+			Message: fmt.Sprintf(format, args...),
+		})
 	}
 
-	for i, line := range lines {
-		if len(line) == 0 {
+	for i, line := range strings.Split(input, "\n") {
+		tokens, err := tokenize(line, i+1)
+		if err != nil {
+			fail(err.token, err.message)
 			continue
 		}
 
-		fields := strings.Fields(line)
-		opname := fields[0]
-
-		if strings.HasPrefix(opname, ";") {
+		if len(tokens) == 0 {
 			continue
 		}
 
+		opToken := tokens[0]
+		opname := opToken.text
+
 		if strings.HasSuffix(opname, ":") {
 			opname = strings.TrimSuffix(opname, ":")
-			labels[opname] = i
+			if len(opname) == 0 {
+				fail(opToken, "label name must not be empty")
+				continue
+			}
+			if len(tokens) > 1 {
+				fail(tokens[1], "unexpected token after label %v", opname)
+			}
+
+			labels[opname] = len(returnValue)
 
 			instruction := new(instructions.Instruction)
 			instruction.OpCode = instructions.INS_VOID
-			instruction.Params = nil
+			instruction.Params = []interface{}{opname}
+			instruction.Line = opToken.line
 
 			returnValue = append(returnValue, *instruction)
 
 			continue
 		}
 
-		var opcode int
-		switch opname {
-		case "ipush":
-			opcode = instructions.INS_IPUSH
-		case "bpush":
-			opcode = instructions.INS_BPUSH
-		case "spush":
-			opcode = instructions.INS_SPUSH
-		case "add":
-			opcode = instructions.INS_ADD
-		case "sub":
-			opcode = instructions.INS_SUB
-		case "mul":
-			opcode = instructions.INS_MUL
-		case "div":
-			opcode = instructions.INS_DIV
-		case "mod":
-			opcode = instructions.INS_MOD
-		case "cmp":
-			opcode = instructions.INS_CMP
-		case "lt":
-			opcode = instructions.INS_LT
-		case "lte":
-			opcode = instructions.INS_LTE
-		case "gt":
-			opcode = instructions.INS_GT
-		case "gte":
-			opcode = instructions.INS_GTE
-		case "req":
-			opcode = instructions.INS_REQ
-		case "store":
-			opcode = instructions.INS_STORE
-		case "load":
-			opcode = instructions.INS_LOAD
-		case "del":
-			opcode = instructions.INS_DEL
-		case "dump":
-			opcode = instructions.INS_DUMP
-		case "jmp":
-			opcode = instructions.INS_JMP
-		case "cjmp":
-			opcode = instructions.INS_CJMP
-		case "sizeof":
-			opcode = instructions.INS_SIZEOF
-		case "swap":
-			opcode = instructions.INS_SWAP
-		case "dup":
-			opcode = instructions.INS_DUP
-		case "drop":
-			opcode = instructions.INS_DROP
-		case "print":
-			opcode = instructions.INS_PRINT
-		case "println":
-			opcode = instructions.INS_PRINTLN
-		case "goto":
-			opcode = instructions.INS_GOTO
-		case "call":
-			opcode = instructions.INS_CALL
-		default:
-			fmt.Printf("Parser: No instruction parsing for %v\n", opname)
-			syscall.Exit(-1)
+		opcode, ok := instructions.Lookup(opname)
+		if !ok {
+			fail(opToken, "unknown instruction %v", opname)
+			continue
 		}
 		parseFunctions := parser.paramsParseFunctionsMap[opcode]
 
-		var params []string = make([]string, 0)
-		fieldsSlice := fields[1:]
-		for j := 0; j < len(fieldsSlice); j++ {
-			param := fieldsSlice[j]
-			if !strings.HasPrefix(param, "\"") || strings.HasSuffix(param, "\"") {
-				params = append(params, param)
-				continue
-			}
-
-			for k := j + 1; k < len(fieldsSlice); k++ {
-				nextParam := fieldsSlice[k]
-				param += " " + nextParam
-				if strings.HasSuffix(nextParam, "\"") {
-					params = append(params, param)
-					j = k
-					break
-				}
-			}
-		}
-
+		params := tokens[1:]
 		if len(params) != len(parseFunctions) {
-			return nil, nil, fmt.Errorf("Parser: Required %v parameters for %v instruction and got %v", len(parseFunctions), opname, len(params))
+			fail(opToken, "%v requires %v parameters and got %v", opname, len(parseFunctions), len(params))
+			continue
 		}
 
 		var parsedParams = make([]interface{}, len(parseFunctions))
-		for i, parseParam := range parseFunctions {
-			unparsedParam := params[i]
-			switch parseParam := parseParam.(type) {
-			case func(string) int:
-				parsedParams[i] = parseParam(unparsedParam)
-			case func(string) string:
-				parsedParams[i] = parseParam(unparsedParam)
-			case func(string) bool:
-				parsedParams[i] = parseParam(unparsedParam)
+		for j, parseParam := range parseFunctions {
+			parsedParam, err := parseParam(params[j].text)
+			if err != nil {
+				fail(params[j], "%v", err)
+				continue
+			}
+
+			if _, ok := parsedParam.(string); ok && instructions.IsJump(opcode) {
+				references = append(references, labelReference{len(returnValue), j, params[j]})
 			}
+			parsedParams[j] = parsedParam
 		}
 
 		instruction := new(instructions.Instruction)
 		instruction.OpCode = opcode
 		instruction.Params = parsedParams
+		instruction.Line = opToken.line
 
 		returnValue = append(returnValue, *instruction)
 	}
 
+	for _, reference := range references {
+		labelName := returnValue[reference.instruction].Params[reference.param].(string)
+		target, ok := labels[labelName]
+		if !ok {
+			fail(reference.token, "undefined label %v", labelName)
+			continue
+		}
+		returnValue[reference.instruction].Params[reference.param] = target
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool {
+			if errs[i].Line != errs[j].Line {
+				return errs[i].Line < errs[j].Line
+			}
+			return errs[i].Column < errs[j].Column
+		})
+		return nil, nil, errs
+	}
+
 	return returnValue, &labels, nil
 }
 
+// operandParsers parses the params of every kind of operand.
+var operandParsers = map[instructions.Operand]paramParser{
+	instructions.OperandInt:        parseIntParam,
+	instructions.OperandFloat:      parseFloatParam,
+	instructions.OperandBool:       parseBoolParam,
+	instructions.OperandString:     parseStringParam,
+	instructions.OperandIdentifier: parseIdentifierParam,
+	instructions.OperandTarget:     parseJumpTargetParam,
+}
+
 func NewParser() *Parser {
 	parser := new(Parser)
-	parser.paramsParseFunctionsMap = map[int][]interface{}{
-		instructions.INS_IPUSH: {
-			parseIntParam,
-		},
-		instructions.INS_SPUSH: {
-			parseStringParam,
-		},
-		instructions.INS_BPUSH: {
-			parseBoolParam,
-		},
-		instructions.INS_ADD: {},
-		instructions.INS_SUB: {},
-		instructions.INS_MUL: {},
-		instructions.INS_DIV: {},
-		instructions.INS_MOD: {},
-		instructions.INS_CMP: {},
-		instructions.INS_LT:  {},
-		instructions.INS_GT:  {},
-		instructions.INS_LTE: {},
-		instructions.INS_GTE: {},
-		instructions.INS_REQ: {
-			parseIdentifierParam,
-		},
-		instructions.INS_STORE: {
-			parseIdentifierParam,
-		},
-		instructions.INS_LOAD: {
-			parseIdentifierParam,
-		},
-		instructions.INS_DEL: {
-			parseIdentifierParam,
-		},
-		instructions.INS_JMP: {
-			parseIntParam,
-		},
-		instructions.INS_CJMP: {
-			parseIntParam,
-			parseIntParam,
-		},
-		instructions.INS_SIZEOF: {},
-		instructions.INS_SWAP:   {},
-		instructions.INS_DUP:    {},
-		instructions.INS_DROP:   {},
-		instructions.INS_CALL: {
-			parseIdentifierParam,
-		},
-		instructions.INS_GOTO: {
-			parseIdentifierParam,
-		},
-		instructions.INS_DUMP: {},
+	parser.paramsParseFunctionsMap = make(map[int][]paramParser)
+
+	// the operands every instruction takes are defined by the instructions package
+	for opCode := 0; ; opCode++ {
+		kinds, ok := instructions.Operands(opCode)
+		if !ok {
+			break
+		}
+
+		parseFunctions := make([]paramParser, len(kinds))
+		for i, kind := range kinds {
+			parseFunctions[i] = operandParsers[kind]
+		}
+		parser.paramsParseFunctionsMap[opCode] = parseFunctions
 	}
 
 	return parser
 }
 
-func parseIntParam(str string) int {
+func parseIntParam(str string) (interface{}, error) {
 	val, err := strconv.Atoi(str)
 	if err != nil {
-		syscall.Exit(-1)
+		return nil, fmt.Errorf("%v is not a valid int", str)
 	}
 
-	return val
+	return val, nil
 }
 
-func parseStringParam(str string) string {
-	if !strings.HasPrefix(str, "\"") {
-		syscall.Exit(-1)
+func parseFloatParam(str string) (interface{}, error) {
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%v is not a valid float", str)
 	}
 
-	if len(str) == 0 || str == " " {
-		syscall.Exit(-1)
+	return val, nil
+}
+
+func parseStringParam(str string) (interface{}, error) {
+	if len(str) < 2 || !strings.HasPrefix(str, "\"") || !strings.HasSuffix(str, "\"") {
+		return nil, fmt.Errorf("%v is not a quoted string", str)
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(str, "\""), "\""), nil
+}
+
+func parseIdentifierParam(str string) (interface{}, error) {
+	if len(str) == 0 || strings.HasPrefix(str, "\"") {
+		return nil, fmt.Errorf("%v is not a valid identifier", str)
 	}
 
-	return strings.TrimSuffix(strings.TrimPrefix(str, "\""), "\"")
+	return str, nil
 }
 
-func parseIdentifierParam(str string) string {
-	if len(str) == 0 || str == " " {
-		syscall.Exit(-1)
+// parseJumpTargetParam accepts either a raw instruction index or a label name.
+// Label names are resolved once parsing is done.
+func parseJumpTargetParam(str string) (interface{}, error) {
+	if val, err := strconv.Atoi(str); err == nil {
+		return val, nil
 	}
 
-	return str
+	return parseIdentifierParam(str)
 }
 
-func parseBoolParam(str string) bool {
+func parseBoolParam(str string) (interface{}, error) {
 	val, err := strconv.ParseBool(str)
 	if err != nil {
-		syscall.Exit(-1)
+		return nil, fmt.Errorf("%v is not a valid bool", str)
 	}
 
-	return val
+	return val, nil
 }
@@ -0,0 +1,62 @@
+package parser_test
+
+import (
+	"errors"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+)
+
+func TestJumpLabels(t *testing.T) {
+	source := "jmp end\nloop:\n; comment\n\nipush 1\ncjmp loop end\nend:\n"
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (*labels)["loop"] != 1 || (*labels)["end"] != 4 {
+		t.Fatalf("unexpected labels %v", *labels)
+	}
+
+	if target := instructionList[0].Params[0]; target != 4 {
+		t.Errorf("expected jmp to 4 and got %v", target)
+	}
+
+	cjmp := instructionList[3]
+	if cjmp.OpCode != instructions.INS_CJMP || cjmp.Params[0] != 1 || cjmp.Params[1] != 4 {
+		t.Errorf("unexpected cjmp %v", cjmp)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	source := "ipush x\nfoo\nspush \"a b\" ; trailing comment\njmp nowhere\nbpush 1 2\nspush \"open\n"
+
+	_, _, err := parser.NewParser().ParseFile("test.sickc", source)
+
+	var errs parser.ParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ParseErrors and got %v", err)
+	}
+
+	expected := []parser.ParseError{
+		{File: "test.sickc", Line: 1, Column: 7, Token: "x"},
+		{File: "test.sickc", Line: 2, Column: 1, Token: "foo"},
+		{File: "test.sickc", Line: 4, Column: 5, Token: "nowhere"},
+		{File: "test.sickc", Line: 5, Column: 1, Token: "bpush"},
+		{File: "test.sickc", Line: 6, Column: 7, Token: "\"open"},
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v errors and got %v:\n%v", len(expected), len(errs), errs)
+	}
+
+	for i, expectedErr := range expected {
+		got := errs[i]
+		got.Message = ""
+		if got != expectedErr {
+			t.Errorf("expected %+v and got %+v", expectedErr, got)
+		}
+	}
+}
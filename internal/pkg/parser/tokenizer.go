@@ -0,0 +1,56 @@
+package parser
+
+type token struct {
+	text   string
+	line   int
+	column int
+}
+
+type tokenizeError struct {
+	token   token
+	message string
+}
+
+// tokenize splits a single source line into whitespace separated tokens.
+// Quoted strings are kept as one token including their quotes and a token
+// starting with ; comments out the rest of the line.
+func tokenize(line string, lineNumber int) ([]token, *tokenizeError) {
+	var tokens []token
+
+	for i := 0; i < len(line); {
+		if isSpace(line[i]) {
+			i++
+			continue
+		}
+
+		if line[i] == ';' {
+			break
+		}
+
+		start := i
+		if line[i] == '"' {
+			i++
+			for i < len(line) && line[i] != '"' {
+				i++
+			}
+
+			if i == len(line) {
+				tok := token{line[start:], lineNumber, start + 1}
+				return nil, &tokenizeError{tok, "unterminated string"}
+			}
+			i++
+		} else {
+			for i < len(line) && !isSpace(line[i]) {
+				i++
+			}
+		}
+
+		tokens = append(tokens, token{line[start:i], lineNumber, start + 1})
+	}
+
+	return tokens, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
@@ -0,0 +1,96 @@
+package register_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+	"mvmo.dev/sickvm/internal/pkg/register"
+)
+
+// the programs are the ones the interpreter is benchmarked with
+const counting = `ipush 0
+store i
+ipush 0
+store sum
+loop:
+load i
+ipush 100000
+lt
+cjmp body end
+body:
+load sum
+load i
+add
+store sum
+load i
+ipush 1
+add
+store i
+jmp loop
+end:
+load sum
+println`
+
+const fibonacci = `ipush 20
+call fib
+println
+jmp end
+fib:
+local n
+load n
+ipush 2
+lt
+cjmp base recurse
+base:
+load n
+ret
+recurse:
+load n
+ipush 1
+sub
+call fib
+load n
+ipush 2
+sub
+call fib
+add
+ret
+end:`
+
+func benchmark(b *testing.B, source string) {
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("stack", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := interpreter.NewInterpreter(instructionList, labels, interpreter.WithStdout(ioutil.Discard)).Run(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("register", func(b *testing.B) {
+		program, err := register.Translate(instructionList, labels)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := register.NewMachine(program, register.WithStdout(ioutil.Discard)).Run(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCounting(b *testing.B) {
+	benchmark(b, counting)
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	benchmark(b, fibonacci)
+}
@@ -0,0 +1,135 @@
+package register
+
+import (
+	"errors"
+	"fmt"
+
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// frame is pushed by call and popped by ret. It remembers where to continue
+// once the procedure returns and holds the variables declared with local.
+type frame struct {
+	returnAddress int
+	fp            int // frame pointer of the caller
+	locals        map[string]types.SickObject
+}
+
+// handler is installed by try and removed by endtry.
+type handler struct {
+	target     int
+	stackDepth int
+	frameDepth int
+}
+
+func (machine *Machine) currentFrame() *frame {
+	if len(machine.frames) == 0 {
+		return nil
+	}
+	return &machine.frames[len(machine.frames)-1]
+}
+
+// lookup resolves identifier in the locals of the current frame first and
+// in the global storage after that.
+func (machine *Machine) lookup(identifier string) (types.SickObject, bool) {
+	if frame := machine.currentFrame(); frame != nil {
+		if value, ok := frame.locals[identifier]; ok {
+			return value, true
+		}
+	}
+
+	value, ok := machine.storage[identifier]
+	return value, ok
+}
+
+// assign updates a local of the current frame if it has one called
+// identifier, otherwise the global storage.
+func (machine *Machine) assign(identifier string, value types.SickObject) {
+	if frame := machine.currentFrame(); frame != nil {
+		if _, ok := frame.locals[identifier]; ok {
+			frame.locals[identifier] = value
+			return
+		}
+	}
+
+	machine.storage[identifier] = value
+}
+
+// declareLocal stores value in the current frame, shadowing a global with the
+// same identifier. Outside of a procedure the value is stored globally.
+func (machine *Machine) declareLocal(identifier string, value types.SickObject) {
+	frame := machine.currentFrame()
+	if frame == nil {
+		machine.storage[identifier] = value
+		return
+	}
+
+	if frame.locals == nil {
+		frame.locals = make(map[string]types.SickObject)
+	}
+	frame.locals[identifier] = value
+}
+
+func (machine *Machine) remove(identifier string) {
+	if frame := machine.currentFrame(); frame != nil {
+		if _, ok := frame.locals[identifier]; ok {
+			delete(frame.locals, identifier)
+			return
+		}
+	}
+
+	delete(machine.storage, identifier)
+}
+
+// popFrame removes the innermost frame and returns its return address and
+// the frame pointer of the caller.
+func (machine *Machine) popFrame() (int, int) {
+	last := len(machine.frames) - 1
+	returnAddress, fp := machine.frames[last].returnAddress, machine.frames[last].fp
+	machine.frames[last] = frame{}
+	machine.frames = machine.frames[:last]
+
+	// handlers installed by the procedure don't outlive it
+	for len(machine.handlers) > 0 && machine.handlers[len(machine.handlers)-1].frameDepth > last {
+		machine.handlers = machine.handlers[:len(machine.handlers)-1]
+	}
+	return returnAddress, fp
+}
+
+// catch hands err to the innermost handler like the interpreter does. The
+// stack without the operands of the failing instruction has the given depth
+// and frame pointer. It returns the index of the handler code, the depth of
+// the stack after the thrown value or the error message was put on it and the
+// frame pointer of the procedure the handler belongs to. If err can't be
+// caught, it returns the error to fail with instead.
+func (machine *Machine) catch(err error, depth int, fp int) (int, int, int, error) {
+	if len(machine.handlers) == 0 {
+		return 0, 0, 0, err
+	}
+
+	last := len(machine.handlers) - 1
+	handler := machine.handlers[last]
+	if depth < handler.stackDepth {
+		// Translate rejects protected code taking the stack below the depth
+		// at the try, but not procedures called from it. The handler code
+		// expects the registers as they were at the try.
+		return 0, 0, 0, fmt.Errorf("%w, the register machine can't catch it below stack depth %v of the try", err, handler.stackDepth)
+	}
+	machine.handlers = machine.handlers[:last]
+
+	for len(machine.frames) > handler.frameDepth {
+		_, fp = machine.popFrame()
+	}
+
+	var value types.SickObject
+	var exception *interpreter.Exception
+	if errors.As(err, &exception) {
+		value = exception.Value
+	} else {
+		value = types.SickString{Value: err.Error()}
+	}
+	machine.registers[handler.stackDepth] = value
+
+	return handler.target, handler.stackDepth + 1, fp, nil
+}
@@ -0,0 +1,371 @@
+package register
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/operations"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// contextCheckInterval is the amount of instructions RunContext executes
+// between checks of its context, like the interpreter does.
+const contextCheckInterval = 1024
+
+// Machine executes a Program. Its registers hold what would be the object
+// stack of the interpreter, every procedure addresses them relative to the
+// depth of the stack when it was called.
+type Machine struct {
+	program *Program
+
+	maxCallDepth int
+
+	stdout io.Writer
+	stderr io.Writer // receives diagnostics like the output of dump
+	stdin  *bufio.Reader
+
+	pc        int
+	fp        int // frame pointer of the innermost procedure
+	depth     int // depth of the stack where execution stopped
+	registers []types.SickObject
+	frames    []frame
+	storage   map[string]types.SickObject
+	handlers  []handler
+}
+
+// Option configures optional behaviour of a Machine.
+type Option func(*Machine)
+
+// WithMaxCallDepth limits how many calls can be pending at once, which
+// stops runaway recursion. It defaults to 10000.
+func WithMaxCallDepth(depth int) Option {
+	return func(machine *Machine) {
+		machine.maxCallDepth = depth
+	}
+}
+
+// WithStdout sets where print and println write to, os.Stdout by default.
+func WithStdout(w io.Writer) Option {
+	return func(machine *Machine) {
+		machine.stdout = w
+	}
+}
+
+// WithStderr sets where diagnostics like the output of dump are written to, os.Stderr by default.
+func WithStderr(w io.Writer) Option {
+	return func(machine *Machine) {
+		machine.stderr = w
+	}
+}
+
+// WithStdin sets where input is read from, os.Stdin by default.
+func WithStdin(r io.Reader) Option {
+	return func(machine *Machine) {
+		machine.stdin = bufio.NewReader(r)
+	}
+}
+
+func NewMachine(program *Program, options ...Option) *Machine {
+	machine := new(Machine)
+	machine.program = program
+	machine.registers = make([]types.SickObject, program.registers)
+	machine.storage = make(map[string]types.SickObject)
+	machine.maxCallDepth = interpreter.DefaultMaxCallDepth
+	machine.stdout = os.Stdout
+	machine.stderr = os.Stderr
+
+	for _, option := range options {
+		option(machine)
+	}
+
+	if machine.stdin == nil {
+		machine.stdin = bufio.NewReader(os.Stdin)
+	}
+
+	return machine
+}
+
+// Stack returns what would be the SickObjectStack of the interpreter, the head being the last element.
+func (machine *Machine) Stack() []types.SickObject {
+	stack := make([]types.SickObject, machine.depth)
+	copy(stack, machine.registers)
+	return stack
+}
+
+// Storage returns the global values stored by identifier. The map is owned by the
+// machine and must not be modified.
+func (machine *Machine) Storage() map[string]types.SickObject {
+	return machine.storage
+}
+
+// Halted reports whether the program counter moved past the last instruction.
+func (machine *Machine) Halted() bool {
+	return machine.pc >= len(machine.program.Instructions)
+}
+
+// Run executes the program until it ends or fails. Running again after an
+// error retries the failing instruction.
+func (machine *Machine) Run() error {
+	return machine.RunContext(context.Background())
+}
+
+// RunContext is like Run, but stops with an error wrapping ctx.Err() once ctx is done.
+func (machine *Machine) RunContext(ctx context.Context) error {
+	if machine.Halted() {
+		return nil
+	}
+
+	code := machine.program.Instructions
+	registers := machine.registers
+	fp := machine.fp
+
+	// the depth after the last instruction executed is the depth of the stack
+	// once the program ends, a return counts as the call it returns from
+	i, last := machine.pc, -1
+	for n := 0; i < len(code); i, n = i+1, n+1 {
+		op := &code[i]
+
+		if n%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				if op.Constant != nil {
+					registers[fp+op.B] = op.Constant
+				}
+				machine.stop(i, fp, fp+op.Depth)
+				return machine.newRuntimeError(i, err)
+			}
+		}
+
+		var err error
+		if op.Depth < op.Pops && fp+op.Depth < op.Pops {
+			err = fmt.Errorf("%w at instruction %v (%v needs %v, have %v)", interpreter.ErrStackUnderflow, op.Source, instructions.Mnemonic(op.OpCode), op.Pops, fp+op.Depth)
+		} else {
+			last = i
+
+			switch op.OpCode {
+			case instructions.INS_IPUSH, instructions.INS_SPUSH, instructions.INS_BPUSH, instructions.INS_FPUSH:
+				registers[fp+op.Dst] = op.Value
+				continue
+			case instructions.INS_ADD, instructions.INS_SUB, instructions.INS_MUL, instructions.INS_DIV, instructions.INS_MOD,
+				instructions.INS_CMP, instructions.INS_LT, instructions.INS_GT, instructions.INS_LTE, instructions.INS_GTE:
+				var result types.SickObject
+				if result, err = operations.Binary(op.OpCode, registers[fp+op.A], operand(registers, fp, op)); err != nil {
+					break
+				}
+				registers[fp+op.Dst] = result
+				continue
+			case instructions.INS_REQ:
+				if err = operations.Require(registers[fp+op.A], op.Name); err != nil {
+					break
+				}
+				continue
+			case instructions.INS_STORE:
+				machine.assign(op.Name, registers[fp+op.A])
+				continue
+			case instructions.INS_LOCAL:
+				machine.declareLocal(op.Name, registers[fp+op.A])
+				continue
+			case instructions.INS_LOAD:
+				value, ok := machine.lookup(op.Name)
+				if !ok {
+					err = fmt.Errorf("undefined identifier %v", op.Name)
+					break
+				}
+				registers[fp+op.Dst] = value
+				continue
+			case instructions.INS_DEL:
+				machine.remove(op.Name)
+				continue
+			case instructions.INS_JMP:
+				i = op.Target - 1
+				continue
+			case instructions.INS_CJMP:
+				var condition bool
+				if condition, err = operations.Condition(registers[fp+op.A]); err != nil {
+					break
+				}
+				if condition {
+					i = op.Target - 1
+				} else {
+					i = op.Alternative - 1
+				}
+				continue
+			case instructions.INS_SIZEOF:
+				var size types.SickObject
+				if size, err = operations.Sizeof(registers[fp+op.A]); err != nil {
+					break
+				}
+				registers[fp+op.Dst] = size
+				continue
+			case instructions.INS_SWAP:
+				registers[fp+op.A], registers[fp+op.B] = registers[fp+op.B], registers[fp+op.A]
+				continue
+			case instructions.INS_DUP:
+				registers[fp+op.Dst] = registers[fp+op.A]
+				continue
+			case instructions.INS_DROP, instructions.INS_VOID:
+				continue
+			case instructions.INS_PRINT:
+				if _, err = fmt.Fprint(machine.stdout, registers[fp+op.A].ToHuman()); err != nil {
+					break
+				}
+				continue
+			case instructions.INS_PRINTLN:
+				if _, err = fmt.Fprintln(machine.stdout, registers[fp+op.A].ToHuman()); err != nil {
+					break
+				}
+				continue
+			case instructions.INS_CALL:
+				if op.Target < 0 {
+					err = fmt.Errorf("undefined label %v", op.Name)
+					break
+				}
+				if machine.maxCallDepth > 0 && len(machine.frames) >= machine.maxCallDepth {
+					err = fmt.Errorf("%w: more than %v pending calls", interpreter.ErrCallStackOverflow, machine.maxCallDepth)
+					break
+				}
+				machine.frames = append(machine.frames, frame{returnAddress: i + 1, fp: fp})
+				fp += op.Depth
+				if needed := fp + machine.program.registers; needed > len(registers) {
+					registers = append(registers, make([]types.SickObject, needed-len(registers))...)
+					machine.registers = registers
+				}
+				i = op.Target - 1
+				continue
+			case instructions.INS_NATIVE:
+				err = fmt.Errorf("undefined native %v", op.Name)
+			case instructions.INS_TRY:
+				machine.handlers = append(machine.handlers, handler{op.Target, fp + op.Depth, len(machine.frames)})
+				continue
+			case instructions.INS_ENDTRY:
+				if len(machine.handlers) == 0 {
+					err = fmt.Errorf("endtry without try")
+					break
+				}
+				machine.handlers = machine.handlers[:len(machine.handlers)-1]
+				continue
+			case instructions.INS_THROW:
+				err = &interpreter.Exception{Value: registers[fp+op.A]}
+			case instructions.INS_RET:
+				if len(machine.frames) == 0 {
+					err = fmt.Errorf("ret without a pending call")
+					break
+				}
+				i, fp = machine.popFrame()
+				i, last = i-1, i-1
+				continue
+			case instructions.INS_ARG:
+				if len(machine.frames) == 0 {
+					err = fmt.Errorf("arg outside of a procedure")
+					break
+				}
+				if op.N < 0 || op.N >= fp || -1-op.N >= op.Depth {
+					err = fmt.Errorf("argument %v is out of range, the caller left %v objects", op.N, fp)
+					break
+				}
+				registers[fp+op.Dst] = registers[fp-1-op.N]
+				continue
+			case instructions.INS_GOTO:
+				if op.Name == "$" {
+					if len(machine.frames) == 0 {
+						err = fmt.Errorf("goto $ without a pending call")
+						break
+					}
+					i, fp = machine.popFrame()
+					i, last = i-1, i-1
+					continue
+				}
+				if op.Target < 0 {
+					err = fmt.Errorf("undefined label %v", op.Name)
+					break
+				}
+				i = op.Target - 1
+				continue
+			case instructions.INS_DUMP:
+				if err = operations.Dump(machine.stderr, registers[:fp+op.Depth]); err != nil {
+					break
+				}
+				continue
+			case instructions.INS_READLN, instructions.INS_READINT, instructions.INS_READALL, instructions.INS_EOF:
+				var result types.SickObject
+				if result, err = operations.Read(op.OpCode, machine.stdin); err != nil {
+					break
+				}
+				registers[fp+op.Dst] = result
+				continue
+			default:
+				var result types.SickObject
+				if result, err = operations.Collection(op.OpCode, registers[fp+op.Depth-op.Pops:fp+op.Depth]); err != nil {
+					break
+				}
+				registers[fp+op.Dst] = result
+				continue
+			}
+		}
+
+		// A failing instruction leaves the stack as it was before it, only a
+		// folded constant still has to be put in place.
+		if op.Constant != nil {
+			registers[fp+op.B] = op.Constant
+		}
+		depth := fp + op.Depth
+
+		// the handler doesn't get the operands back, unless there weren't enough
+		remaining := depth
+		if remaining >= op.Pops {
+			remaining -= op.Pops
+		}
+		target, handlerDepth, handlerFp, err := machine.catch(err, remaining, fp)
+		if err == nil {
+			fp = handlerFp
+			if target >= len(code) {
+				machine.stop(target, fp, handlerDepth)
+				return nil
+			}
+			i, last = target-1, -1
+			continue
+		}
+
+		machine.stop(i, fp, depth)
+		return machine.newRuntimeError(i, err)
+	}
+
+	depth := machine.depth
+	if last >= 0 {
+		depth = fp + code[last].After
+	}
+	machine.stop(i, fp, depth)
+	return nil
+}
+
+// stop remembers where execution stopped and the depth of the stack there.
+func (machine *Machine) stop(pc int, fp int, depth int) {
+	machine.pc, machine.fp, machine.depth = pc, fp, depth
+}
+
+// operand returns the head operand of a binary operation, which is either a
+// folded constant or in register B.
+func operand(registers []types.SickObject, fp int, op *Instruction) types.SickObject {
+	if op.Constant != nil {
+		return op.Constant
+	}
+	return registers[fp+op.B]
+}
+
+func (machine *Machine) newRuntimeError(index int, err error) *interpreter.RuntimeError {
+	code := machine.program.Instructions
+	op := code[index]
+
+	var trace []interpreter.TraceEntry
+	for _, frame := range machine.frames {
+		call := code[frame.returnAddress-1]
+		trace = append(trace, interpreter.TraceEntry{Instruction: call.Source, Line: call.Line})
+	}
+
+	instruction := instructions.Instruction{OpCode: op.OpCode, Line: op.Line}
+	return interpreter.NewRuntimeError(instruction, op.Source, machine.registers[:machine.depth], trace, err)
+}
@@ -0,0 +1,213 @@
+package register_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+	"mvmo.dev/sickvm/internal/pkg/register"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// result is everything observable about a run.
+type result struct {
+	output  string
+	err     string
+	stack   string
+	storage string
+}
+
+func describe(output *bytes.Buffer, err error, stack []types.SickObject, storage map[string]types.SickObject) result {
+	var described result
+	described.output = output.String()
+	if err != nil {
+		described.err = err.Error()
+		if runtimeErr, ok := err.(*interpreter.RuntimeError); ok {
+			described.err += fmt.Sprintf(" %v", format(runtimeErr.Stack))
+		}
+	}
+	described.stack = format(stack)
+
+	keys := make([]string, 0, len(storage))
+	for key := range storage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		described.storage += fmt.Sprintf("%v=%v ", key, types.Format(storage[key]))
+	}
+	return described
+}
+
+func format(stack []types.SickObject) string {
+	formatted := make([]string, len(stack))
+	for i, object := range stack {
+		formatted[i] = types.Format(object)
+	}
+	return strings.Join(formatted, " ")
+}
+
+// compare runs a program on both backends and fails if they behave differently.
+func compare(t *testing.T, name string, instructionList []instructions.Instruction, labels *map[string]int, input string) {
+	t.Helper()
+
+	var output bytes.Buffer
+	vm := interpreter.NewInterpreter(instructionList, labels, interpreter.WithStdout(&output), interpreter.WithStderr(&output), interpreter.WithStdin(strings.NewReader(input)))
+	err := vm.Run()
+	expected := describe(&output, err, vm.Stack(), vm.Storage())
+
+	program, err := register.Translate(instructionList, labels)
+	if err != nil {
+		t.Errorf("%v: %v", name, err)
+		return
+	}
+
+	output.Reset()
+	machine := register.NewMachine(program, register.WithStdout(&output), register.WithStderr(&output), register.WithStdin(strings.NewReader(input)))
+	err = machine.Run()
+	actual := describe(&output, err, machine.Stack(), machine.Storage())
+
+	if actual != expected {
+		t.Errorf("%v: register machine returned\n%+v\ninstead of\n%+v", name, actual, expected)
+	}
+}
+
+func TestMachine(t *testing.T) {
+	testCases := []string{
+		"ipush 2\nipush 3\nadd\nprintln",
+		"spush \"a\"\nipush 2\nadd\nspush \"b\"\nswap\nsub",
+		"spush \"abc\"\nipush 1\nsub\nipush 4\nsub",
+		"fpush 1.5\nipush 2\nmul\nipush 3\nlt\nipush 1\nipush 1\ncmp",
+		"ipush 7\nspush \"a\"\nipush 2\nmul",
+		"ipush 1\nipush 0\ndiv",
+		"ipush 1\ndup\ndup\ndrop\nswap\nsizeof",
+		"spush \"x\"\nreq sick::int",
+		"ipush 1\nadd",
+		"load missing",
+		"ipush 3\nstore x\nload x\nload x\nmul\ndel x\nload x",
+		"ipush 1\ndump\nspush \"a\"\ndump",
+		"ipush 0\nstore i\nloop:\nload i\nipush 10\nlt\ncjmp body end\nbody:\nload i\nprint\nload i\nipush 1\nadd\nstore i\njmp loop\nend:\nspush \"!\"\nprintln",
+		"ipush 1\ncjmp 0 0",
+		"jmp 5",
+		"ipush 1\nipush 2\nbpush true\ncjmp 9 9\nadd",
+		// procedures
+		"ipush 2\nipush 3\ncall add\nprintln\njmp end\nadd:\narg 0\narg 1\nadd\nswap\ndrop\nswap\ndrop\nret\nend:",
+		"ipush 1\nstore x\ncall proc\nload x\njmp end\nproc:\nipush 2\nlocal x\nload x\nipush 3\nstore x\nload x\nadd\ngoto $\nend:",
+		"call proc\nproc:\nipush 1\nreq sick::string",
+		"call missing",
+		"goto $",
+		"ret",
+		"arg 0",
+		"ipush 1\ncall proc\njmp end\nproc:\ndrop\narg 0\nend:",
+		"call proc\nproc:\ncall proc",
+		"ipush 10\ncall count\njmp end\ncount:\ndup\nipush 0\ncmp\ncjmp done more\ndone:\nret\nmore:\ndup\nprintln\nipush 1\nsub\ncall count\nret\nend:",
+		"native \"missing\"",
+		// exceptions
+		"try handler\nipush 1\nthrow\nendtry\nhandler:\nprintln",
+		"ipush 5\ntry handler\nipush 1\nipush 0\ndiv\ndrop\nendtry\njmp end\nhandler:\nprintln\nend:",
+		"try handler\ncall proc\nendtry\njmp end\nhandler:\nprintln\njmp end\nproc:\nipush 1\nipush 2\nspush \"boom\"\nthrow\nend:",
+		"try handler\nspush \"x\"\nthrow\nhandler:",
+		"ipush 1\nthrow",
+		"ipush 1\ntry handler\nipush 2\nthrow\nhandler:",
+		"call proc\njmp end\nproc:\nipush 1\ntry handler\nipush 2\nthrow\nhandler:\nret\nend:",
+		"endtry",
+		// collections and input
+		"anew\nipush 1\napush\nipush 2\napush\ndup\nipush 0\nipush 5\naset\ndup\nalen\nswap\nipush 0\nipush 1\naslice\nipush 0\naget",
+		"anew\nipush 3\naget",
+		"mnew\nspush \"a\"\nipush 1\nmput\ndup\nspush \"a\"\nipush 0\nmget\nswap\ndup\nspush \"b\"\nmhas\nswap\ndup\nmkeys\nswap\nspush \"a\"\nmdel\nmlen",
+		"ipush 1\nmlen",
+		"readln\nreadint\nadd\nprintln\neof\nreadall\nreadln",
+	}
+
+	for _, source := range testCases {
+		instructionList, labels, err := parser.NewParser().Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare(t, fmt.Sprintf("%q", source), instructionList, labels, "line\n41\nrest")
+	}
+}
+
+func TestMachineExamples(t *testing.T) {
+	files, err := filepath.Glob("../../../examples/*.sickc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		instructionList, labels, err := parser.NewParser().ParseFile(file, string(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare(t, file, instructionList, labels, "")
+	}
+}
+
+func TestTranslateRejects(t *testing.T) {
+	testCases := []struct {
+		source string
+		err    string
+	}{
+		// different depths on two paths
+		{"readint\nipush 0\ngt\ncjmp a b\na:\nipush 1\nb:\nprintln", "is reached with stack depths"},
+		// a loop leaving an object in every iteration
+		{"ipush 3\nloop:\ndup\nipush 1\nsub\ndup\nipush 0\ngt\ncjmp loop end\nend:", "is reached with stack depths"},
+		// a procedure falling through into another one
+		{"call a\ncall b\njmp end\na:\nipush 1\nb:\nipush 2\nret\nend:", "is reached with stack depths"},
+		// protected code taking the stack below the depth at the try
+		{"ipush 1\nipush 2\ntry handler\ndrop\ndrop\nspush \"boom\"\nthrow\nhandler:\nprintln\nprintln", "takes the stack below depth 2 of its try"},
+		{"ipush 1\ntry handler\nthrow\nhandler:", "takes the stack below depth 1 of its try"},
+		// the handler reached inside and outside of the try
+		{"bpush true\ncjmp a b\na:\ntry handler\nb:\nendtry\njmp end\nhandler:\ndrop\nend:", "is reached with different tries installed"},
+	}
+
+	for _, testCase := range testCases {
+		instructionList, labels, err := parser.NewParser().Parse(testCase.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := register.Translate(instructionList, labels); err == nil || !strings.Contains(err.Error(), testCase.err) {
+			t.Errorf("%q: expected an error containing %q and got %v", testCase.source, testCase.err, err)
+		}
+	}
+
+	malformed := []instructions.Instruction{{OpCode: instructions.INS_JMP}}
+	if _, err := register.Translate(malformed, nil); err == nil || !strings.Contains(err.Error(), "jmp requires 1 parameters") {
+		t.Errorf("expected an error for a malformed instruction and got %v", err)
+	}
+}
+
+// TestCatchBelowTry runs a procedure that takes the stack below the depth at
+// the try of its caller, which Translate can't see.
+func TestCatchBelowTry(t *testing.T) {
+	source := "ipush 1\nipush 2\ntry handler\ncall proc\nhandler:\nprintln\njmp end\nproc:\ndrop\ndrop\nspush \"boom\"\nthrow\nend:"
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	program, err := register.Translate(instructionList, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = register.NewMachine(program).Run()
+	var runtimeErr *interpreter.RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.OpCode != instructions.INS_THROW || !strings.Contains(err.Error(), "below stack depth 2 of the try") {
+		t.Errorf("expected throw to fail below the depth of the try, got %v", err)
+	}
+}
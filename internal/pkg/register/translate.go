@@ -0,0 +1,405 @@
+// Package register is an alternative backend that executes programs on
+// virtual registers instead of an object stack. Translate turns the
+// instructions of a stack program into register instructions, and a Machine
+// executes them with the same results as the stack interpreter.
+//
+// The register machine doesn't support host functions, gas metering and
+// stack limits. A program calling a native fails like it would on an
+// interpreter without natives.
+package register
+
+import (
+	"fmt"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// Instruction is an instruction of the register machine. It carries the
+// opcode of the stack instruction it was translated from. Registers are
+// numbered relative to the frame pointer, which is the depth of the object
+// stack when the current procedure was called, so register k holds what
+// would be the kth object of the procedure on the stack.
+type Instruction struct {
+	OpCode int
+	Dst    int // register receiving the result
+	A      int // registers of the operands, the deepest first
+	B      int
+	C      int
+
+	// Constant replaces the operand in register B if it isn't nil. It is set
+	// for operations on a value pushed right before them.
+	Constant types.SickObject
+
+	Value       types.SickObject // pushed by ipush, spush, bpush and fpush
+	Name        string           // identifier, label or native
+	Target      int              // jump target, -1 for call and goto of an undefined label
+	Alternative int              // target of cjmp if the condition is false
+	N           int              // argument of arg
+
+	Depth int // stack depth before the instruction, relative to the frame pointer
+	After int // stack depth after the instruction
+	Pops  int // objects taken from the stack, checked at runtime if Depth is lower
+
+	Source int // index of the stack instruction
+	Line   int
+}
+
+// Program is a stack program translated for the register machine.
+type Program struct {
+	Instructions []Instruction
+	registers    int // most registers a procedure uses
+}
+
+// path is what is known about the stack when an instruction is reached: its
+// depth and the depths at the tries whose handlers are installed, the
+// innermost last.
+type path struct {
+	depth int
+	tries []int
+}
+
+// translator keeps the stack depth before every instruction of the program.
+// Every procedure starts at depth 0 and leaves its caller's stack deeper or
+// shallower by the same amount on every return.
+type translator struct {
+	instructions []instructions.Instruction
+	labels       map[string]int
+	depths       []int
+	reached      []bool
+}
+
+// Translate converts a stack program into a register program. This is only
+// possible if the stack depth at every instruction is the same on all paths
+// leading to it. Some programs the verifier accepts don't meet that, like a
+// loop leaving an object on the stack in every iteration or a procedure
+// falling through into another one, Translate returns an error for them.
+// Handler code expects the stack as it was at the try, so code protected by
+// a try must not take the stack below that depth either.
+func Translate(instructionList []instructions.Instruction, labels *map[string]int) (*Program, error) {
+	for i, instruction := range instructionList {
+		if err := instructions.Validate(instruction); err != nil {
+			return nil, fmt.Errorf("instruction %v: %v", i, err)
+		}
+	}
+
+	translator := &translator{instructions: instructionList, labels: map[string]int{}}
+	if labels != nil {
+		translator.labels = *labels
+	}
+
+	entries := []int{}
+	seen := map[int]bool{}
+	for _, instruction := range instructionList {
+		if instruction.OpCode != instructions.INS_CALL {
+			continue
+		}
+		if target, ok := translator.label(instruction); ok && !seen[target] {
+			seen[target] = true
+			entries = append(entries, target)
+		}
+	}
+
+	// Procedures can call themselves, so the amount they leave on the stack
+	// is refined until it doesn't change anymore. Calls of procedures that
+	// aren't known to return yet don't continue.
+	summaries := map[int]int{}
+	for {
+		translator.depths = make([]int, len(instructionList))
+		translator.reached = make([]bool, len(instructionList))
+
+		if _, _, err := translator.propagate(0, summaries); err != nil {
+			return nil, err
+		}
+
+		next := map[int]int{}
+		for _, entry := range entries {
+			delta, returns, err := translator.propagate(entry, summaries)
+			if err != nil {
+				return nil, err
+			}
+			if returns {
+				next[entry] = delta
+			}
+		}
+
+		if len(next) == len(summaries) {
+			break
+		}
+		summaries = next
+	}
+
+	return translator.emit(summaries), nil
+}
+
+func (translator *translator) label(instruction instructions.Instruction) (int, bool) {
+	target, ok := translator.labels[instruction.Params[0].(string)]
+	return target, ok && target >= 0 && target <= len(translator.instructions)
+}
+
+// propagate computes the stack depths of everything reachable from entry
+// within the same procedure. It returns how the procedure changes the stack
+// of its caller and whether it returns at all.
+func (translator *translator) propagate(entry int, summaries map[int]int) (int, bool, error) {
+	delta, returns := 0, false
+	work := []int{entry}
+	paths := map[int]path{entry: {}}
+
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if i >= len(translator.instructions) {
+			continue
+		}
+
+		depth, tries := paths[i].depth, paths[i].tries
+		if translator.reached[i] && translator.depths[i] != depth {
+			return 0, false, fmt.Errorf("instruction %v is reached with stack depths %v and %v", i, translator.depths[i], depth)
+		}
+		translator.reached[i], translator.depths[i] = true, depth
+
+		instruction := translator.instructions[i]
+		effect := instructions.Effect(instruction.OpCode)
+		after := depth - effect.Pops + effect.Pushes
+
+		if len(tries) > 0 && depth-effect.Pops < tries[len(tries)-1] {
+			return 0, false, fmt.Errorf("instruction %v takes the stack below depth %v of its try", i, tries[len(tries)-1])
+		}
+
+		next := tries
+		var successors []int
+		switch instruction.OpCode {
+		case instructions.INS_JMP:
+			successors = []int{instruction.Params[0].(int)}
+		case instructions.INS_CJMP:
+			successors = []int{instruction.Params[0].(int), instruction.Params[1].(int)}
+		case instructions.INS_TRY:
+			successors = []int{i + 1}
+			next = append(tries[:len(tries):len(tries)], after)
+			handler := instruction.Params[0].(int)
+			if err := translator.reach(handler, path{after + 1, tries}, paths, &work); err != nil {
+				return 0, false, err
+			}
+		case instructions.INS_ENDTRY:
+			// without a try before it in this procedure the handler is one
+			// of a caller, which the procedure can't take the stack below
+			successors = []int{i + 1}
+			if len(tries) > 0 {
+				next = tries[:len(tries)-1]
+			}
+		case instructions.INS_CALL:
+			if target, ok := translator.label(instruction); ok {
+				if summary, returns := summaries[target]; returns {
+					after += summary
+					successors = []int{i + 1}
+				}
+			}
+		case instructions.INS_GOTO:
+			if instruction.Params[0] == "$" {
+				if entry != 0 {
+					if returns && delta != depth {
+						return 0, false, fmt.Errorf("procedure at instruction %v returns with stack depths %v and %v", entry, delta, depth)
+					}
+					delta, returns = depth, true
+				}
+			} else if target, ok := translator.label(instruction); ok {
+				successors = []int{target}
+			}
+		case instructions.INS_RET:
+			if entry != 0 {
+				if returns && delta != depth {
+					return 0, false, fmt.Errorf("procedure at instruction %v returns with stack depths %v and %v", entry, delta, depth)
+				}
+				delta, returns = depth, true
+			}
+		case instructions.INS_THROW, instructions.INS_NATIVE:
+			// native always fails as the register machine has no natives
+		default:
+			successors = []int{i + 1}
+		}
+
+		for _, successor := range successors {
+			if err := translator.reach(successor, path{after, next}, paths, &work); err != nil {
+				return 0, false, err
+			}
+		}
+	}
+
+	return delta, returns, nil
+}
+
+// reach records that target is reached on reached and queues it the first time.
+func (translator *translator) reach(target int, reached path, paths map[int]path, work *[]int) error {
+	if known, ok := paths[target]; ok {
+		if known.depth != reached.depth {
+			return fmt.Errorf("instruction %v is reached with stack depths %v and %v", target, known.depth, reached.depth)
+		}
+		if !sameTries(known.tries, reached.tries) {
+			return fmt.Errorf("instruction %v is reached with different tries installed", target)
+		}
+		return nil
+	}
+
+	paths[target] = reached
+	*work = append(*work, target)
+	return nil
+}
+
+func sameTries(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// emit builds the register instructions. Voids and unreachable instructions
+// are left out and constants are folded into the operation using them.
+func (translator *translator) emit(summaries map[int]int) *Program {
+	program := &Program{}
+	code := make([]Instruction, len(translator.instructions))
+	keep := make([]bool, len(translator.instructions))
+
+	for i, instruction := range translator.instructions {
+		if !translator.reached[i] || instruction.OpCode == instructions.INS_VOID {
+			continue
+		}
+		keep[i] = true
+
+		d := translator.depths[i]
+		effect := instructions.Effect(instruction.OpCode)
+		op := Instruction{
+			OpCode: instruction.OpCode,
+			Depth:  d,
+			After:  d - effect.Pops + effect.Pushes,
+			Pops:   effect.Pops,
+			Source: i,
+			Line:   instruction.Line,
+		}
+
+		// results replace the deepest operand, the operands lie below the depth
+		op.Dst = d - effect.Pops
+		switch effect.Pops {
+		case 1:
+			op.A = d - 1
+		case 2:
+			op.A, op.B = d-2, d-1
+		case 3:
+			op.A, op.B, op.C = d-3, d-2, d-1
+		}
+
+		switch instruction.OpCode {
+		case instructions.INS_IPUSH, instructions.INS_SPUSH, instructions.INS_BPUSH, instructions.INS_FPUSH:
+			op.Value = types.AnyToSickObject(instruction.Params[0])
+		case instructions.INS_DUP:
+			op.Dst = d
+		case instructions.INS_REQ, instructions.INS_STORE, instructions.INS_LOCAL, instructions.INS_LOAD, instructions.INS_DEL, instructions.INS_NATIVE:
+			op.Name = instruction.Params[0].(string)
+		case instructions.INS_JMP, instructions.INS_TRY:
+			op.Target = instruction.Params[0].(int)
+		case instructions.INS_CJMP:
+			op.Target, op.Alternative = instruction.Params[0].(int), instruction.Params[1].(int)
+		case instructions.INS_CALL, instructions.INS_GOTO:
+			op.Name = instruction.Params[0].(string)
+			op.Target = -1
+			if target, ok := translator.label(instruction); ok {
+				op.Target = target
+			}
+			if summary, ok := summaries[op.Target]; ok && instruction.OpCode == instructions.INS_CALL {
+				op.After = d + summary
+			}
+		case instructions.INS_ARG:
+			op.N = instruction.Params[0].(int)
+		}
+
+		size := d + effect.Pushes
+		if instruction.OpCode == instructions.INS_TRY {
+			// the handler starts with the exception on top of the depth at try
+			size = d + 1
+		}
+		if size > program.registers {
+			program.registers = size
+		}
+		code[i] = op
+	}
+
+	translator.foldConstants(code, keep)
+
+	// drop what isn't kept and move the targets along
+	newIndex := make([]int, len(code)+1)
+	for i := range code {
+		newIndex[i+1] = newIndex[i]
+		if keep[i] {
+			newIndex[i+1]++
+		}
+	}
+	relocate := func(target int) int {
+		if target < 0 || target > len(code) {
+			return target
+		}
+		return newIndex[target]
+	}
+
+	for i, op := range code {
+		if !keep[i] {
+			continue
+		}
+		switch op.OpCode {
+		case instructions.INS_JMP, instructions.INS_CJMP, instructions.INS_TRY, instructions.INS_CALL, instructions.INS_GOTO:
+			op.Target = relocate(op.Target)
+			op.Alternative = relocate(op.Alternative)
+		}
+		program.Instructions = append(program.Instructions, op)
+	}
+
+	return program
+}
+
+// foldConstants lets operations whose head was pushed by the instruction
+// right before them use it as a constant, so the push can be left out.
+func (translator *translator) foldConstants(code []Instruction, keep []bool) {
+	leaders := make([]bool, len(code)+1)
+	for _, index := range translator.labels {
+		if index >= 0 && index <= len(code) {
+			leaders[index] = true
+		}
+	}
+	for i, op := range code {
+		if !keep[i] {
+			continue
+		}
+
+		switch op.OpCode {
+		case instructions.INS_JMP, instructions.INS_TRY:
+			if op.Target >= 0 && op.Target < len(leaders) {
+				leaders[op.Target] = true
+			}
+		case instructions.INS_CJMP:
+			for _, target := range []int{op.Target, op.Alternative} {
+				if target >= 0 && target < len(leaders) {
+					leaders[target] = true
+				}
+			}
+		case instructions.INS_CALL:
+			leaders[i+1] = true
+		}
+	}
+
+	for i := 1; i < len(code); i++ {
+		push := code[i-1]
+		if !keep[i-1] || !keep[i] || leaders[i] || push.Value == nil {
+			continue
+		}
+
+		switch code[i].OpCode {
+		case instructions.INS_ADD, instructions.INS_SUB, instructions.INS_MUL, instructions.INS_DIV, instructions.INS_MOD,
+			instructions.INS_CMP, instructions.INS_LT, instructions.INS_GT, instructions.INS_LTE, instructions.INS_GTE:
+			code[i].Constant = push.Value
+			keep[i-1] = false
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"fmt"
+	"math"
+)
+
+// Arithmetic applies one of the operators +, -, *, / and % to two numbers.
+// The result is a SickInt if both operands are ints, otherwise both operands
+// are promoted to float and the result is a SickFloat.
+func Arithmetic(operator string, left SickObject, right SickObject) (SickObject, error) {
+	leftNum, leftOk := left.(SickNum)
+	rightNum, rightOk := right.(SickNum)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("can't do %v %v %v", left.TypeName(), operator, right.TypeName())
+	}
+
+	leftInt, leftIsInt := left.(SickInt)
+	rightInt, rightIsInt := right.(SickInt)
+	if leftIsInt && rightIsInt {
+		return intArithmetic(operator, leftInt.Value, rightInt.Value)
+	}
+
+	a, b := leftNum.AsFloat(), rightNum.AsFloat()
+	switch operator {
+	case "+":
+		return SickFloat{a + b}, nil
+	case "-":
+		return SickFloat{a - b}, nil
+	case "*":
+		return SickFloat{a * b}, nil
+	case "/":
+		return SickFloat{a / b}, nil
+	case "%":
+		return SickFloat{math.Mod(a, b)}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %v", operator)
+}
+
+func intArithmetic(operator string, a int, b int) (SickObject, error) {
+	switch operator {
+	case "+":
+		return SickInt{a + b}, nil
+	case "-":
+		return SickInt{a - b}, nil
+	case "*":
+		return SickInt{a * b}, nil
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return SickInt{a / b}, nil
+	case "%":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return SickInt{a % b}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %v", operator)
+}
+
+// Compare returns -1, 0 or 1 if left is less than, equal to or greater than right.
+// Ints are compared as ints so big values don't lose precision.
+func Compare(left SickNum, right SickNum) int {
+	leftInt, leftIsInt := left.(SickInt)
+	rightInt, rightIsInt := right.(SickInt)
+	if leftIsInt && rightIsInt {
+		switch {
+		case leftInt.Value < rightInt.Value:
+			return -1
+		case leftInt.Value > rightInt.Value:
+			return 1
+		}
+		return 0
+	}
+
+	a, b := left.AsFloat(), right.AsFloat()
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Equal reports whether two objects are equal, numbers are compared by value
+// so an int and a float can be equal.
+func Equal(left SickObject, right SickObject) bool {
+	leftNum, leftOk := left.(SickNum)
+	rightNum, rightOk := right.(SickNum)
+	if leftOk && rightOk {
+		if leftFloat, ok := left.(SickFloat); ok && math.IsNaN(leftFloat.Value) {
+			return false
+		}
+		if rightFloat, ok := right.(SickFloat); ok && math.IsNaN(rightFloat.Value) {
+			return false
+		}
+		return Compare(leftNum, rightNum) == 0
+	}
+
+	return left == right
+}
@@ -0,0 +1,120 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SickArray is a mutable list of objects. It is always used as a pointer, so
+// every copy, like the one made by dup, refers to the same elements.
+type SickArray struct {
+	Elements []SickObject
+}
+
+func NewSickArray(elements ...SickObject) *SickArray {
+	return &SickArray{elements}
+}
+
+func (*SickArray) TypeName() string {
+	return "sick::array"
+}
+
+func (sickArray *SickArray) ToHuman() string {
+	var builder strings.Builder
+	formatNested(&builder, sickArray, make(map[SickObject]bool))
+	return builder.String()
+}
+
+func (sickArray *SickArray) Len() int {
+	return len(sickArray.Elements)
+}
+
+func (sickArray *SickArray) Get(index int) (SickObject, error) {
+	if err := sickArray.checkIndex(index); err != nil {
+		return nil, err
+	}
+	return sickArray.Elements[index], nil
+}
+
+func (sickArray *SickArray) Set(index int, value SickObject) error {
+	if err := sickArray.checkIndex(index); err != nil {
+		return err
+	}
+	sickArray.Elements[index] = value
+	return nil
+}
+
+func (sickArray *SickArray) Append(value SickObject) {
+	sickArray.Elements = append(sickArray.Elements, value)
+}
+
+// Slice returns a new array holding a copy of the elements from start up to, but excluding, end.
+func (sickArray *SickArray) Slice(start int, end int) (*SickArray, error) {
+	if start < 0 || end > len(sickArray.Elements) || start > end {
+		return nil, fmt.Errorf("slice [%v:%v] out of range for array of length %v", start, end, len(sickArray.Elements))
+	}
+
+	elements := make([]SickObject, end-start)
+	copy(elements, sickArray.Elements[start:end])
+	return &SickArray{elements}, nil
+}
+
+func (sickArray *SickArray) checkIndex(index int) error {
+	if index < 0 || index >= len(sickArray.Elements) {
+		return fmt.Errorf("index %v out of range for array of length %v", index, len(sickArray.Elements))
+	}
+	return nil
+}
+
+// Format renders object like ToHuman, but quotes strings so they can be told
+// apart from other values.
+func Format(object SickObject) string {
+	var builder strings.Builder
+	formatNested(&builder, object, make(map[SickObject]bool))
+	return builder.String()
+}
+
+// formatNested renders containers with their contents. Strings inside of a
+// container are quoted and containers that contain themselves are cut short.
+func formatNested(builder *strings.Builder, object SickObject, seen map[SickObject]bool) {
+	switch object := object.(type) {
+	case *SickArray:
+		if seen[object] {
+			builder.WriteString("[...]")
+			return
+		}
+		seen[object] = true
+		defer delete(seen, object)
+
+		builder.WriteString("[")
+		for i, element := range object.Elements {
+			if i > 0 {
+				builder.WriteString(", ")
+			}
+			formatNested(builder, element, seen)
+		}
+		builder.WriteString("]")
+	case *SickMap:
+		if seen[object] {
+			builder.WriteString("{...}")
+			return
+		}
+		seen[object] = true
+		defer delete(seen, object)
+
+		builder.WriteString("{")
+		for i, key := range object.keys {
+			if i > 0 {
+				builder.WriteString(", ")
+			}
+			formatNested(builder, key, seen)
+			builder.WriteString(": ")
+			formatNested(builder, object.entries[key], seen)
+		}
+		builder.WriteString("}")
+	case SickString:
+		builder.WriteString("\"" + object.ToHuman() + "\"")
+	default:
+		builder.WriteString(object.ToHuman())
+	}
+}
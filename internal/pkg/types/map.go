@@ -0,0 +1,100 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SickMap associates hashable objects with values and remembers the order
+// keys were inserted in. Like SickArray it is always used as a pointer.
+type SickMap struct {
+	entries map[SickObject]SickObject
+	keys    []SickObject
+}
+
+func NewSickMap() *SickMap {
+	return &SickMap{entries: make(map[SickObject]SickObject)}
+}
+
+func (*SickMap) TypeName() string {
+	return "sick::map"
+}
+
+func (sickMap *SickMap) ToHuman() string {
+	var builder strings.Builder
+	formatNested(&builder, sickMap, make(map[SickObject]bool))
+	return builder.String()
+}
+
+func (sickMap *SickMap) Len() int {
+	return len(sickMap.keys)
+}
+
+func (sickMap *SickMap) Put(key SickObject, value SickObject) error {
+	key, err := mapKey(key)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := sickMap.entries[key]; !ok {
+		sickMap.keys = append(sickMap.keys, key)
+	}
+	sickMap.entries[key] = value
+	return nil
+}
+
+func (sickMap *SickMap) Get(key SickObject) (SickObject, bool, error) {
+	key, err := mapKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, ok := sickMap.entries[key]
+	return value, ok, nil
+}
+
+func (sickMap *SickMap) Delete(key SickObject) error {
+	key, err := mapKey(key)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := sickMap.entries[key]; !ok {
+		return nil
+	}
+
+	delete(sickMap.entries, key)
+	for i, existing := range sickMap.keys {
+		if existing == key {
+			sickMap.keys = append(sickMap.keys[:i], sickMap.keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Keys returns a new array with every key in insertion order.
+func (sickMap *SickMap) Keys() *SickArray {
+	keys := make([]SickObject, len(sickMap.keys))
+	copy(keys, sickMap.keys)
+	return &SickArray{keys}
+}
+
+// mapKey makes sure key is hashable. Floats without a fraction become ints,
+// so keys that are equal by value find the same entry.
+func mapKey(key SickObject) (SickObject, error) {
+	switch key := key.(type) {
+	case SickString, SickInt, SickBool:
+		return key, nil
+	case SickFloat:
+		if math.IsNaN(key.Value) {
+			return nil, fmt.Errorf("NaN can't be used as a map key")
+		}
+		if key.Value == math.Trunc(key.Value) && math.Abs(key.Value) < 1<<53 {
+			return SickInt{int(key.Value)}, nil
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("%v can't be used as a map key", key.TypeName())
+}
@@ -19,6 +19,8 @@ func AnyToSickObject(any interface{}) SickObject {
 		return SickInt{any}
 	case bool:
 		return SickBool{any}
+	case float64:
+		return SickFloat{any}
 	default:
 		log.Fatalf("Types: No parsing for type %v", reflect.TypeOf(any))
 		syscall.Exit(0)
@@ -64,6 +66,8 @@ func (sickString SickString) Add(toAdd SickObject) (SickObject, error) {
 		return SickString{toAdd.Value + sickString.Value}, nil
 	case SickBool:
 		return SickString{toAdd.ToHuman() + sickString.Value}, nil
+	case SickFloat:
+		return SickString{toAdd.ToHuman() + sickString.Value}, nil
 	}
 	return nil, fmt.Errorf("can't do %v + %v", sickString.TypeName(), toAdd.TypeName())
 }
@@ -92,6 +96,8 @@ func (sickInt SickInt) Add(toAdd SickObject) (SickObject, error) {
 	switch toAdd := toAdd.(type) {
 	case SickInt:
 		return SickInt{toAdd.Value + sickInt.Value}, nil
+	case SickFloat:
+		return SickFloat{toAdd.Value + float64(sickInt.Value)}, nil
 	case SickString:
 		return SickString{toAdd.Value + sickInt.ToHuman()}, nil
 	}
@@ -102,6 +108,8 @@ func (sickInt SickInt) Subtract(toSubtract SickObject) (SickObject, error) {
 	switch toSubtract := toSubtract.(type) {
 	case SickInt:
 		return SickInt{toSubtract.Value - sickInt.Value}, nil
+	case SickFloat:
+		return SickFloat{toSubtract.Value - float64(sickInt.Value)}, nil
 	}
 	return nil, fmt.Errorf("can't do %v - %v", sickInt.TypeName(), toSubtract.TypeName())
 }
@@ -114,6 +122,53 @@ func (sickInt SickInt) AsFloat() float64 {
 	return float64(sickInt.Value)
 }
 
+type SickFloat struct {
+	Value float64
+}
+
+func (SickFloat) TypeName() string {
+	return "sick::float"
+}
+
+// ToHuman always renders a decimal point or exponent, so floats can be told apart from ints.
+func (sickFloat SickFloat) ToHuman() string {
+	str := strconv.FormatFloat(sickFloat.Value, 'g', -1, 64)
+	if strings.ContainsAny(str, ".eIN") {
+		return str
+	}
+	return str + ".0"
+}
+
+func (sickFloat SickFloat) Add(toAdd SickObject) (SickObject, error) {
+	switch toAdd := toAdd.(type) {
+	case SickInt:
+		return SickFloat{float64(toAdd.Value) + sickFloat.Value}, nil
+	case SickFloat:
+		return SickFloat{toAdd.Value + sickFloat.Value}, nil
+	case SickString:
+		return SickString{toAdd.Value + sickFloat.ToHuman()}, nil
+	}
+	return nil, fmt.Errorf("can't do %v + %v", toAdd.TypeName(), sickFloat.TypeName())
+}
+
+func (sickFloat SickFloat) Subtract(toSubtract SickObject) (SickObject, error) {
+	switch toSubtract := toSubtract.(type) {
+	case SickInt:
+		return SickFloat{float64(toSubtract.Value) - sickFloat.Value}, nil
+	case SickFloat:
+		return SickFloat{toSubtract.Value - sickFloat.Value}, nil
+	}
+	return nil, fmt.Errorf("can't do %v - %v", toSubtract.TypeName(), sickFloat.TypeName())
+}
+
+func (sickFloat SickFloat) AsInt() int {
+	return int(sickFloat.Value)
+}
+
+func (sickFloat SickFloat) AsFloat() float64 {
+	return sickFloat.Value
+}
+
 type SickBool struct {
 	Value bool
 }
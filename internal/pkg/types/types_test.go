@@ -37,3 +37,131 @@ func TestAddition(t *testing.T) {
 		}
 	}
 }
+
+func TestArithmetic(t *testing.T) {
+	testCases := []struct {
+		operator string
+		left     types.SickObject
+		right    types.SickObject
+		expected types.SickObject
+	}{
+		{"+", types.SickInt{Value: 1}, types.SickInt{Value: 2}, types.SickInt{Value: 3}},
+		{"+", types.SickInt{Value: 1}, types.SickFloat{Value: 0.5}, types.SickFloat{Value: 1.5}},
+		{"-", types.SickFloat{Value: 1}, types.SickInt{Value: 3}, types.SickFloat{Value: -2}},
+		{"*", types.SickInt{Value: 3}, types.SickInt{Value: 4}, types.SickInt{Value: 12}},
+		{"*", types.SickFloat{Value: 1.5}, types.SickInt{Value: 4}, types.SickFloat{Value: 6}},
+		{"/", types.SickInt{Value: 7}, types.SickInt{Value: 2}, types.SickInt{Value: 3}},
+		{"/", types.SickInt{Value: 7}, types.SickFloat{Value: 2}, types.SickFloat{Value: 3.5}},
+		{"%", types.SickInt{Value: 7}, types.SickInt{Value: 4}, types.SickInt{Value: 3}},
+		{"%", types.SickFloat{Value: 7.5}, types.SickInt{Value: 2}, types.SickFloat{Value: 1.5}},
+	}
+
+	for _, testCase := range testCases {
+		result, err := types.Arithmetic(testCase.operator, testCase.left, testCase.right)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if result != testCase.expected {
+			t.Errorf("%v %v %v: expected %v(%v) and got %v(%v)", testCase.left.ToHuman(), testCase.operator, testCase.right.ToHuman(), testCase.expected.ToHuman(), testCase.expected.TypeName(), result.ToHuman(), result.TypeName())
+		}
+	}
+
+	invalid := []struct {
+		operator string
+		left     types.SickObject
+		right    types.SickObject
+	}{
+		{"/", types.SickInt{Value: 1}, types.SickInt{Value: 0}},
+		{"%", types.SickInt{Value: 1}, types.SickInt{Value: 0}},
+		{"*", types.SickString{Value: "a"}, types.SickInt{Value: 2}},
+		{"-", types.SickBool{Value: true}, types.SickFloat{Value: 2}},
+	}
+
+	for _, testCase := range invalid {
+		if _, err := types.Arithmetic(testCase.operator, testCase.left, testCase.right); err == nil {
+			t.Errorf("expected an error for %v %v %v", testCase.left.ToHuman(), testCase.operator, testCase.right.ToHuman())
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	if !types.Equal(types.SickInt{Value: 2}, types.SickFloat{Value: 2}) {
+		t.Errorf("expected 2 and 2.0 to be equal")
+	}
+
+	if types.Equal(types.SickInt{Value: 2}, types.SickString{Value: "2"}) {
+		t.Errorf("expected 2 and \"2\" to differ")
+	}
+
+	if (types.SickFloat{Value: 2}).ToHuman() != "2.0" {
+		t.Errorf("expected floats to render with a decimal point")
+	}
+}
+
+func TestArray(t *testing.T) {
+	array := types.NewSickArray(types.SickInt{Value: 1}, types.SickString{Value: "two"})
+	array.Append(types.NewSickArray(types.SickBool{Value: true}))
+	array.Append(array)
+
+	if human := array.ToHuman(); human != `[1, "two", [true], [...]]` {
+		t.Errorf("unexpected rendering %v", human)
+	}
+
+	slice, err := array.Slice(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := slice.Set(0, types.SickInt{Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if element, _ := array.Get(1); element != (types.SickString{Value: "two"}) {
+		t.Errorf("slice must not share elements with the array, got %v", element.ToHuman())
+	}
+
+	if _, err := array.Get(4); err == nil {
+		t.Errorf("expected an error for an index out of range")
+	}
+	if _, err := array.Slice(2, 1); err == nil {
+		t.Errorf("expected an error for an invalid slice")
+	}
+}
+
+func TestMap(t *testing.T) {
+	sickMap := types.NewSickMap()
+	entries := []struct {
+		key   types.SickObject
+		value types.SickObject
+	}{
+		{types.SickString{Value: "b"}, types.SickInt{Value: 1}},
+		{types.SickInt{Value: 2}, types.SickBool{Value: true}},
+		{types.SickFloat{Value: 2}, types.SickString{Value: "two"}},
+		{types.SickBool{Value: false}, types.NewSickArray()},
+	}
+
+	for _, entry := range entries {
+		if err := sickMap.Put(entry.key, entry.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if human := sickMap.ToHuman(); human != `{"b": 1, 2: "two", false: []}` {
+		t.Errorf("unexpected rendering %v", human)
+	}
+
+	if value, ok, _ := sickMap.Get(types.SickInt{Value: 2}); !ok || value != (types.SickString{Value: "two"}) {
+		t.Errorf("expected 2.0 and 2 to be the same key")
+	}
+
+	if err := sickMap.Delete(types.SickString{Value: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := sickMap.Get(types.SickString{Value: "b"}); ok || sickMap.Len() != 2 {
+		t.Errorf("expected b to be deleted")
+	}
+
+	if err := sickMap.Put(types.NewSickArray(), types.SickInt{Value: 1}); err == nil {
+		t.Errorf("expected arrays to be rejected as keys")
+	}
+}
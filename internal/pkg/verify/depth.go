@@ -0,0 +1,215 @@
+package verify
+
+import (
+	"reflect"
+	"sort"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+)
+
+// depth is the abstract value of the stack depth before an instruction.
+type depth struct {
+	visited bool
+	known   bool // false once paths with different depths merged
+	value   int
+}
+
+// summary describes how a procedure changes the stack depth of its caller.
+type summary struct {
+	known bool
+	delta int
+}
+
+// StackDepths returns how many objects the stack holds at least before each
+// instruction, or -1 where that isn't known, e.g. because paths with
+// different depths meet there or the instruction is never reached. Inside
+// procedures only the objects the procedure pushed itself are counted.
+func StackDepths(instructionList []instructions.Instruction, labels *map[string]int) []int {
+	verifier := &verifier{
+		instructions: instructionList,
+		labels:       map[string]int{},
+		natives:      map[string]bool{},
+	}
+	if labels != nil {
+		verifier.labels = *labels
+	}
+
+	depths := make([]int, len(instructionList))
+	for i := range depths {
+		depths[i] = -1
+	}
+	if !verifier.checkOperands() {
+		return depths
+	}
+
+	verifier.checkStackDepths()
+	for i, depth := range verifier.depths {
+		switch {
+		case !depth.visited || !depth.known:
+		case depth.value < 0:
+			// a procedure took objects of its caller
+			depths[i] = 0
+		default:
+			depths[i] = depth.value
+		}
+	}
+	return depths
+}
+
+// checkStackDepths interprets the program over stack depths instead of
+// values. Every procedure is analysed on its own, starting at depth 0, and
+// calls use the summary of the procedure. As procedures can be recursive,
+// the summaries are refined until they don't change anymore.
+func (verifier *verifier) checkStackDepths() {
+	procedures := map[int]bool{}
+	for i := range verifier.instructions {
+		if target, ok := verifier.callTarget(i); ok {
+			procedures[target] = true
+		}
+	}
+
+	entries := make([]int, 0, len(procedures))
+	for entry := range procedures {
+		entries = append(entries, entry)
+	}
+	sort.Ints(entries)
+
+	reported := len(verifier.diagnostics)
+	summaries := map[int]summary{}
+	for round := 0; round <= len(entries)+1; round++ {
+		verifier.diagnostics = verifier.diagnostics[:reported]
+
+		verifier.depths = make([]depth, len(verifier.instructions))
+		next := map[int]summary{}
+		verifier.analyse(0, true, summaries)
+		for _, entry := range entries {
+			if procedureSummary, returns := verifier.analyse(entry, false, summaries); returns {
+				next[entry] = procedureSummary
+			}
+		}
+
+		if reflect.DeepEqual(next, summaries) {
+			break
+		}
+		summaries = next
+	}
+}
+
+// analyse propagates stack depths from entry and reports where they don't
+// match. Underflows are only reported for the main program, procedures are
+// expected to take their arguments from the caller. For procedures it
+// returns their summary and whether they return at all.
+func (verifier *verifier) analyse(entry int, main bool, summaries map[int]summary) (summary, bool) {
+	end := len(verifier.instructions)
+	depths := make([]depth, end+1)
+	depths[entry] = depth{visited: true, known: true}
+	work := []int{entry}
+
+	merge := func(from int, to int, incoming depth) {
+		if to < 0 || to >= end {
+			return
+		}
+
+		current := &depths[to]
+		switch {
+		case !current.visited:
+			*current = incoming
+			work = append(work, to)
+		case !current.known:
+		case !incoming.known || incoming.value != current.value:
+			if incoming.known {
+				verifier.report(Error, to, "stack depth mismatch: %v coming from %v, %v on another path", incoming.value, verifier.location(from), current.value)
+			}
+			current.known = false
+			work = append(work, to)
+		}
+	}
+
+	var result summary
+	returns := false
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		before := depths[i]
+		instruction := verifier.instructions[i]
+		effect := instructions.Effect(instruction.OpCode)
+
+		if main && before.known && before.value < effect.Pops {
+			verifier.report(Error, i, "stack underflow: %v needs %v objects, have %v", instructions.Mnemonic(instruction.OpCode), effect.Pops, before.value)
+			before.known = false
+		}
+
+		if verifier.isReturn(i) {
+			if main {
+				continue
+			}
+
+			switch {
+			case !returns:
+				result = summary{before.known, before.value}
+				returns = true
+			case result.known && (!before.known || before.value != result.delta):
+				if before.known {
+					verifier.report(Error, i, "procedure changes the stack depth by %v here and by %v on another path", before.value, result.delta)
+				}
+				result.known = false
+			}
+			continue
+		}
+
+		after := before
+		after.value += effect.Pushes - effect.Pops
+
+		switch instruction.OpCode {
+		case instructions.INS_CALL:
+			target, ok := verifier.callTarget(i)
+			if !ok {
+				// a native, its results aren't known
+				after.known = false
+				break
+			}
+
+			procedureSummary, known := summaries[target]
+			if !known {
+				// the procedure isn't known to return yet
+				continue
+			}
+			after.known = after.known && procedureSummary.known
+			after.value += procedureSummary.delta
+		case instructions.INS_NATIVE:
+			after.known = false
+		case instructions.INS_TRY:
+			// the handler starts with the exception on top of the depth at try
+			for _, target := range verifier.targets(instruction) {
+				merge(i, target, depth{true, after.known, after.value + 1})
+			}
+			merge(i, i+1, after)
+			continue
+		}
+
+		for _, successor := range verifier.successors(i) {
+			merge(i, successor, after)
+		}
+	}
+
+	verifier.recordDepths(depths[:end])
+	return result, returns
+}
+
+// recordDepths merges the depths found by one analysis into verifier.depths.
+// An instruction reached by several procedures gets the lowest of them.
+func (verifier *verifier) recordDepths(depths []depth) {
+	for i, incoming := range depths {
+		current := &verifier.depths[i]
+		switch {
+		case !incoming.visited:
+		case !current.visited:
+			*current = incoming
+		case !incoming.known:
+			current.known = false
+		case incoming.value < current.value:
+			current.value = incoming.value
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package verify
+
+import (
+	"reflect"
+	"strings"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// typeSet is the set of types a stack slot can hold at an instruction.
+type typeSet uint8
+
+const (
+	stringType typeSet = 1 << iota
+	intType
+	floatType
+	boolType
+	arrayType
+	mapType
+
+	numberType = intType | floatType
+	scalarType = stringType | intType | floatType | boolType
+	anyType    = scalarType | arrayType | mapType
+)
+
+var typeNames = []struct {
+	set  typeSet
+	name string
+}{
+	{stringType, types.SickString{}.TypeName()},
+	{intType, types.SickInt{}.TypeName()},
+	{floatType, types.SickFloat{}.TypeName()},
+	{boolType, types.SickBool{}.TypeName()},
+	{arrayType, (*types.SickArray)(nil).TypeName()},
+	{mapType, (*types.SickMap)(nil).TypeName()},
+}
+
+func (set typeSet) String() string {
+	if set == anyType {
+		return "any"
+	}
+
+	var names []string
+	for _, typeName := range typeNames {
+		if set&typeName.set != 0 {
+			names = append(names, typeName.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// typeOf returns the set holding only the type named like TypeName does.
+func typeOf(name string) typeSet {
+	for _, typeName := range typeNames {
+		if typeName.name == name {
+			return typeName.set
+		}
+	}
+	return 0
+}
+
+// signature describes the operands an instruction requires, deepest first,
+// and the types of its results.
+type signature struct {
+	operands []typeSet
+	results  []typeSet
+}
+
+// signatures lists the instructions whose result types don't depend on the
+// types of their operands. Instructions that move objects around, like dup,
+// and the arithmetic ones are handled on their own.
+var signatures = map[int]signature{
+	instructions.INS_IPUSH:   {nil, []typeSet{intType}},
+	instructions.INS_SPUSH:   {nil, []typeSet{stringType}},
+	instructions.INS_BPUSH:   {nil, []typeSet{boolType}},
+	instructions.INS_FPUSH:   {nil, []typeSet{floatType}},
+	instructions.INS_CMP:     {[]typeSet{anyType, anyType}, []typeSet{boolType}},
+	instructions.INS_LT:      {[]typeSet{numberType, numberType}, []typeSet{boolType}},
+	instructions.INS_GT:      {[]typeSet{numberType, numberType}, []typeSet{boolType}},
+	instructions.INS_LTE:     {[]typeSet{numberType, numberType}, []typeSet{boolType}},
+	instructions.INS_GTE:     {[]typeSet{numberType, numberType}, []typeSet{boolType}},
+	instructions.INS_STORE:   {[]typeSet{anyType}, nil},
+	instructions.INS_LOAD:    {nil, []typeSet{anyType}},
+	instructions.INS_CJMP:    {[]typeSet{boolType}, nil},
+	instructions.INS_SIZEOF:  {[]typeSet{stringType | arrayType | mapType}, []typeSet{intType}},
+	instructions.INS_DROP:    {[]typeSet{anyType}, nil},
+	instructions.INS_PRINT:   {[]typeSet{anyType}, nil},
+	instructions.INS_PRINTLN: {[]typeSet{anyType}, nil},
+	instructions.INS_ANEW:    {nil, []typeSet{arrayType}},
+	instructions.INS_AGET:    {[]typeSet{arrayType, intType}, []typeSet{anyType}},
+	instructions.INS_ASET:    {[]typeSet{arrayType, intType, anyType}, []typeSet{arrayType}},
+	instructions.INS_APUSH:   {[]typeSet{arrayType, anyType}, []typeSet{arrayType}},
+	instructions.INS_ASLICE:  {[]typeSet{arrayType, intType, intType}, []typeSet{arrayType}},
+	instructions.INS_ALEN:    {[]typeSet{arrayType}, []typeSet{intType}},
+	instructions.INS_MNEW:    {nil, []typeSet{mapType}},
+	instructions.INS_MPUT:    {[]typeSet{mapType, scalarType, anyType}, []typeSet{mapType}},
+	instructions.INS_MGET:    {[]typeSet{mapType, scalarType, anyType}, []typeSet{anyType}},
+	instructions.INS_MHAS:    {[]typeSet{mapType, scalarType}, []typeSet{boolType}},
+	instructions.INS_MDEL:    {[]typeSet{mapType, scalarType}, []typeSet{mapType}},
+	instructions.INS_MKEYS:   {[]typeSet{mapType}, []typeSet{arrayType}},
+	instructions.INS_MLEN:    {[]typeSet{mapType}, []typeSet{intType}},
+	instructions.INS_READLN:  {nil, []typeSet{stringType}},
+	instructions.INS_READINT: {nil, []typeSet{intType}},
+	instructions.INS_READALL: {nil, []typeSet{stringType}},
+	instructions.INS_EOF:     {nil, []typeSet{boolType}},
+	instructions.INS_LOCAL:   {[]typeSet{anyType}, nil},
+	instructions.INS_ARG:     {nil, []typeSet{anyType}},
+	instructions.INS_THROW:   {[]typeSet{anyType}, nil},
+}
+
+// binaryRules compute the result type of an operation on one type of each
+// operand, 0 meaning the interpreter fails on them.
+var binaryRules = map[int]func(left typeSet, right typeSet) typeSet{
+	instructions.INS_ADD: func(left typeSet, right typeSet) typeSet {
+		if (left == stringType && right&scalarType != 0) || (right == stringType && left&scalarType != 0) {
+			return stringType
+		}
+		return arithmeticResult(left, right)
+	},
+	instructions.INS_SUB: func(left typeSet, right typeSet) typeSet {
+		if left == stringType {
+			if right == intType {
+				return stringType
+			}
+			return 0
+		}
+		return arithmeticResult(left, right)
+	},
+	instructions.INS_MUL: arithmeticResult,
+	instructions.INS_DIV: arithmeticResult,
+	instructions.INS_MOD: arithmeticResult,
+}
+
+var binaryOperators = map[int]string{
+	instructions.INS_ADD: "+",
+	instructions.INS_SUB: "-",
+	instructions.INS_MUL: "*",
+	instructions.INS_DIV: "/",
+	instructions.INS_MOD: "%",
+}
+
+// arithmeticResult follows types.Arithmetic: ints stay ints and any float
+// makes the result a float.
+func arithmeticResult(left typeSet, right typeSet) typeSet {
+	switch {
+	case left == intType && right == intType:
+		return intType
+	case left&numberType != 0 && right&numberType != 0:
+		return floatType
+	}
+	return 0
+}
+
+// typeStack is the abstract object stack, the head being the last slot.
+// Procedures start with an empty stack, base counts the objects of the caller
+// they popped.
+type typeStack struct {
+	visited bool
+	unknown bool // paths with different depths merged or a native was called
+	base    int
+	slots   []typeSet
+}
+
+func (stack *typeStack) pop() typeSet {
+	if len(stack.slots) == 0 {
+		stack.base++
+		return anyType
+	}
+
+	head := stack.slots[len(stack.slots)-1]
+	stack.slots = stack.slots[:len(stack.slots)-1]
+	return head
+}
+
+func (stack *typeStack) push(sets ...typeSet) {
+	stack.slots = append(stack.slots, sets...)
+}
+
+func (stack typeStack) copy() typeStack {
+	stack.slots = append([]typeSet(nil), stack.slots...)
+	return stack
+}
+
+// join merges incoming into stack and reports whether stack changed.
+func (stack *typeStack) join(incoming typeStack) bool {
+	switch {
+	case !stack.visited:
+		*stack = incoming.copy()
+		return true
+	case stack.unknown:
+		return false
+	case incoming.unknown || len(incoming.slots)-incoming.base != len(stack.slots)-stack.base:
+		stack.unknown = true
+		return true
+	}
+
+	// objects of the caller a path popped and pushed again can have any type
+	changed := stack.base < incoming.base
+	for stack.base < incoming.base {
+		stack.base++
+		stack.slots = append([]typeSet{anyType}, stack.slots...)
+	}
+	offset := stack.base - incoming.base
+
+	for i := range stack.slots {
+		joined := anyType
+		if i >= offset {
+			joined = stack.slots[i] | incoming.slots[i-offset]
+		}
+		if joined != stack.slots[i] {
+			stack.slots[i] = joined
+			changed = true
+		}
+	}
+	return changed
+}
+
+// typeSummary describes what a procedure leaves on the stack of its caller.
+type typeSummary struct {
+	unknown bool
+	pops    int
+	results []typeSet
+}
+
+// checkTypes interprets the program over the types of stack slots, like
+// checkStackDepths does over stack depths, and reports instructions that fail
+// for every type their operands can have. Values loaded from storage and
+// returned by natives can have any type, req narrows them down.
+func (verifier *verifier) checkTypes() {
+	var entries []int
+	seen := map[int]bool{}
+	for i := range verifier.instructions {
+		if target, ok := verifier.callTarget(i); ok && !seen[target] {
+			seen[target] = true
+			entries = append(entries, target)
+		}
+	}
+
+	reported := len(verifier.diagnostics)
+	summaries := map[int]typeSummary{}
+	for round := 0; round <= len(entries)+1; round++ {
+		verifier.diagnostics = verifier.diagnostics[:reported]
+
+		next := map[int]typeSummary{}
+		verifier.analyseTypes(0, summaries)
+		for _, entry := range entries {
+			if procedureSummary, returns := verifier.analyseTypes(entry, summaries); returns {
+				next[entry] = procedureSummary
+			}
+		}
+
+		if reflect.DeepEqual(next, summaries) {
+			break
+		}
+		summaries = next
+	}
+}
+
+// analyseTypes propagates the types of stack slots from entry. It returns the
+// summary of the procedure starting at entry and whether it returns at all.
+func (verifier *verifier) analyseTypes(entry int, summaries map[int]typeSummary) (typeSummary, bool) {
+	end := len(verifier.instructions)
+	stacks := make([]typeStack, end+1)
+	stacks[entry] = typeStack{visited: true}
+	work := []int{entry}
+
+	merge := func(to int, incoming typeStack) {
+		if to >= 0 && to < end && stacks[to].join(incoming) {
+			work = append(work, to)
+		}
+	}
+
+	var result typeStack
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		stack := stacks[i].copy()
+		instruction := verifier.instructions[i]
+
+		if verifier.isReturn(i) {
+			result.join(stack)
+			continue
+		}
+
+		if !stack.unknown {
+			verifier.applyTypes(i, &stack, summaries)
+		}
+
+		switch instruction.OpCode {
+		case instructions.INS_CALL:
+			if target, ok := verifier.callTarget(i); ok {
+				if _, returns := summaries[target]; !returns {
+					continue
+				}
+			}
+		case instructions.INS_TRY:
+			// the handler gets the thrown value or the error message
+			handlerStack := stack.copy()
+			handlerStack.push(anyType)
+			for _, target := range verifier.targets(instruction) {
+				merge(target, handlerStack)
+			}
+		}
+
+		for _, successor := range verifier.successors(i) {
+			merge(successor, stack)
+		}
+	}
+
+	if !result.visited {
+		return typeSummary{}, false
+	}
+	return typeSummary{result.unknown, result.base, result.slots}, true
+}
+
+// applyTypes changes stack like the instruction at i changes the object
+// stack and reports if it fails for all types of its operands.
+func (verifier *verifier) applyTypes(i int, stack *typeStack, summaries map[int]typeSummary) {
+	instruction := verifier.instructions[i]
+	mnemonic := instructions.Mnemonic(instruction.OpCode)
+
+	if signature, ok := signatures[instruction.OpCode]; ok {
+		operands := make([]typeSet, len(signature.operands))
+		for j := len(operands) - 1; j >= 0; j-- {
+			operands[j] = stack.pop()
+		}
+		for j, required := range signature.operands {
+			if operands[j]&required == 0 {
+				verifier.report(Error, i, "%v requires %v and got %v", mnemonic, required, operands[j])
+			}
+		}
+		stack.push(signature.results...)
+		return
+	}
+
+	if rule, ok := binaryRules[instruction.OpCode]; ok {
+		right := stack.pop()
+		left := stack.pop()
+
+		var result typeSet
+		for _, leftType := range typeNames {
+			for _, rightType := range typeNames {
+				if left&leftType.set != 0 && right&rightType.set != 0 {
+					result |= rule(leftType.set, rightType.set)
+				}
+			}
+		}
+
+		if result == 0 {
+			verifier.report(Error, i, "can't do %v %v %v", left, binaryOperators[instruction.OpCode], right)
+			result = anyType
+		}
+		stack.push(result)
+		return
+	}
+
+	switch instruction.OpCode {
+	case instructions.INS_REQ:
+		name, _ := instruction.Params[0].(string)
+		required := typeOf(name)
+		head := stack.pop()
+		if head&required == 0 {
+			verifier.report(Error, i, "required type %v and got %v", name, head)
+		}
+		if required == 0 {
+			required = anyType
+		}
+		stack.push(required)
+	case instructions.INS_DUP:
+		head := stack.pop()
+		stack.push(head, head)
+	case instructions.INS_SWAP:
+		head := stack.pop()
+		below := stack.pop()
+		stack.push(head, below)
+	case instructions.INS_NATIVE:
+		stack.unknown = true
+	case instructions.INS_CALL:
+		target, ok := verifier.callTarget(i)
+		if !ok {
+			stack.unknown = true
+			break
+		}
+
+		procedureSummary, ok := summaries[target]
+		if !ok || procedureSummary.unknown {
+			stack.unknown = true
+			break
+		}
+		for j := 0; j < procedureSummary.pops; j++ {
+			stack.pop()
+		}
+		stack.push(procedureSummary.results...)
+	}
+}
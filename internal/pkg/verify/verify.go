@@ -0,0 +1,350 @@
+// Package verify checks parsed programs for mistakes that would otherwise
+// only show up while running them, or not at all.
+package verify
+
+import (
+	"fmt"
+	"sort"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+)
+
+type Severity int
+
+const (
+	Warning Severity = iota // the program runs, but likely not as intended
+	Error                   // the program fails or misbehaves when it gets there
+)
+
+func (severity Severity) String() string {
+	if severity == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a problem found at one instruction of a program.
+type Diagnostic struct {
+	Severity    Severity
+	Instruction int
+	Line        int // source line of the instruction, 0 if unknown
+	Message     string
+}
+
+func (diagnostic Diagnostic) String() string {
+	if diagnostic.Line > 0 {
+		return fmt.Sprintf("line %v: %v: %v", diagnostic.Line, diagnostic.Severity, diagnostic.Message)
+	}
+	return fmt.Sprintf("instruction %v: %v: %v", diagnostic.Instruction, diagnostic.Severity, diagnostic.Message)
+}
+
+// HasErrors reports whether any of diagnostics is an Error.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Option configures optional behaviour of Verify.
+type Option func(*verifier)
+
+// WithNatives declares the names of the host functions the program will be
+// run with, so calls to them aren't reported as undefined labels.
+func WithNatives(names ...string) Option {
+	return func(verifier *verifier) {
+		for _, name := range names {
+			verifier.natives[name] = true
+		}
+	}
+}
+
+// WithTypes additionally checks the types of the operands of every
+// instruction, as far as they can be inferred without running the program.
+func WithTypes() Option {
+	return func(verifier *verifier) {
+		verifier.typeCheck = true
+	}
+}
+
+type verifier struct {
+	instructions []instructions.Instruction
+	labels       map[string]int
+	natives      map[string]bool
+	typeCheck    bool
+	diagnostics  []Diagnostic
+	depths       []depth // lowest stack depth before every instruction, set by checkStackDepths
+}
+
+// Verify checks a program as returned by the parser and returns the problems
+// found, ordered by instruction. It reports jumps out of range, undefined and
+// duplicate labels, unreachable code, and paths that reach an instruction
+// with different stack depths. WithTypes enables type checking.
+func Verify(instructionList []instructions.Instruction, labels *map[string]int, options ...Option) []Diagnostic {
+	verifier := &verifier{
+		instructions: instructionList,
+		labels:       map[string]int{},
+		natives:      map[string]bool{},
+	}
+	if labels != nil {
+		verifier.labels = *labels
+	}
+
+	for _, option := range options {
+		option(verifier)
+	}
+
+	// the other checks rely on the params every instruction takes
+	if !verifier.checkOperands() {
+		return verifier.sorted()
+	}
+
+	verifier.checkLabels()
+	verifier.checkTargets()
+	verifier.checkIdentifiers()
+	verifier.checkReachability()
+	verifier.checkStackDepths()
+	if verifier.typeCheck {
+		verifier.checkTypes()
+	}
+
+	return verifier.sorted()
+}
+
+func (verifier *verifier) report(severity Severity, index int, format string, args ...interface{}) {
+	line := 0
+	if index >= 0 && index < len(verifier.instructions) {
+		line = verifier.instructions[index].Line
+	}
+
+	verifier.diagnostics = append(verifier.diagnostics, Diagnostic{severity, index, line, fmt.Sprintf(format, args...)})
+}
+
+// sorted orders the diagnostics by instruction and drops duplicates.
+func (verifier *verifier) sorted() []Diagnostic {
+	sort.SliceStable(verifier.diagnostics, func(i, j int) bool {
+		return verifier.diagnostics[i].Instruction < verifier.diagnostics[j].Instruction
+	})
+
+	var result []Diagnostic
+	seen := map[Diagnostic]bool{}
+	for _, diagnostic := range verifier.diagnostics {
+		if !seen[diagnostic] {
+			seen[diagnostic] = true
+			result = append(result, diagnostic)
+		}
+	}
+	return result
+}
+
+// checkOperands reports instructions with unknown opcodes or params that
+// don't match their opcode and returns whether all of them are well-formed.
+func (verifier *verifier) checkOperands() bool {
+	valid := true
+	for i, instruction := range verifier.instructions {
+		if err := instructions.Validate(instruction); err != nil {
+			verifier.report(Error, i, "%v", err)
+			valid = false
+		}
+	}
+	return valid
+}
+
+// checkLabels reports labels defined more than once and labels pointing
+// outside of the program. The parser keeps the name of every label in the
+// void it places where the label is defined.
+func (verifier *verifier) checkLabels() {
+	defined := map[string]int{}
+	for i, instruction := range verifier.instructions {
+		if instruction.OpCode != instructions.INS_VOID || len(instruction.Params) != 1 {
+			continue
+		}
+
+		name, ok := instruction.Params[0].(string)
+		if !ok {
+			continue
+		}
+
+		if first, ok := defined[name]; ok {
+			verifier.report(Error, i, "label %v is already defined at %v", name, verifier.location(first))
+			continue
+		}
+		defined[name] = i
+	}
+
+	for name, index := range verifier.labels {
+		if index < 0 || index > len(verifier.instructions) {
+			verifier.report(Error, index, "label %v points to instruction %v, outside of the program", name, index)
+		}
+	}
+}
+
+// checkTargets reports jumps outside of the program and calls of labels that don't exist.
+func (verifier *verifier) checkTargets() {
+	for i, instruction := range verifier.instructions {
+		if instructions.IsJump(instruction.OpCode) {
+			for _, param := range instruction.Params {
+				target, ok := param.(int)
+				if !ok || target < 0 || target > len(verifier.instructions) {
+					verifier.report(Error, i, "%v target %v is out of range 0..%v", instructions.Mnemonic(instruction.OpCode), param, len(verifier.instructions))
+				}
+			}
+			continue
+		}
+
+		switch instruction.OpCode {
+		case instructions.INS_CALL, instructions.INS_GOTO:
+			name, _ := instruction.Params[0].(string)
+			if instruction.OpCode == instructions.INS_GOTO && name == "$" {
+				continue
+			}
+			if _, ok := verifier.labels[name]; ok {
+				continue
+			}
+			if instruction.OpCode == instructions.INS_CALL && verifier.natives[name] {
+				continue
+			}
+			verifier.report(Error, i, "undefined label %v", name)
+		case instructions.INS_NATIVE:
+			name, _ := instruction.Params[0].(string)
+			if len(verifier.natives) > 0 && !verifier.natives[name] {
+				verifier.report(Error, i, "undefined native %q", name)
+			}
+		}
+	}
+}
+
+// checkIdentifiers warns about loads of identifiers no instruction ever
+// stores. They can still be provided by the host before the program runs.
+func (verifier *verifier) checkIdentifiers() {
+	stored := map[string]bool{}
+	for _, instruction := range verifier.instructions {
+		if instruction.OpCode == instructions.INS_STORE || instruction.OpCode == instructions.INS_LOCAL {
+			name, _ := instruction.Params[0].(string)
+			stored[name] = true
+		}
+	}
+
+	for i, instruction := range verifier.instructions {
+		if instruction.OpCode != instructions.INS_LOAD {
+			continue
+		}
+
+		name, _ := instruction.Params[0].(string)
+		if !stored[name] {
+			verifier.report(Warning, i, "%v is loaded but never stored", name)
+		}
+	}
+}
+
+// checkReachability warns about instructions no path from the start of the
+// program leads to. Label placeholders don't count as code.
+func (verifier *verifier) checkReachability() {
+	reachable := make([]bool, len(verifier.instructions)+1)
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		if i < 0 || i >= len(verifier.instructions) || reachable[i] {
+			continue
+		}
+		reachable[i] = true
+
+		work = append(work, verifier.successors(i)...)
+		if target, ok := verifier.callTarget(i); ok {
+			work = append(work, target)
+		}
+	}
+
+	inUnreachable := false
+	for i, instruction := range verifier.instructions {
+		if reachable[i] {
+			inUnreachable = false
+			continue
+		}
+		if instruction.OpCode == instructions.INS_VOID || inUnreachable {
+			continue
+		}
+
+		inUnreachable = true
+		verifier.report(Warning, i, "unreachable code")
+	}
+}
+
+// successors returns the instructions control can continue with after the
+// instruction at i inside of the same procedure. A call continues after
+// itself once the procedure returns, a try also continues at its handler.
+func (verifier *verifier) successors(i int) []int {
+	instruction := verifier.instructions[i]
+
+	switch instruction.OpCode {
+	case instructions.INS_JMP:
+		return verifier.targets(instruction)
+	case instructions.INS_CJMP:
+		return verifier.targets(instruction)
+	case instructions.INS_TRY:
+		return append([]int{i + 1}, verifier.targets(instruction)...)
+	case instructions.INS_GOTO:
+		if target, ok := verifier.label(instruction); ok {
+			return []int{target}
+		}
+		return nil
+	case instructions.INS_RET, instructions.INS_THROW:
+		return nil
+	}
+
+	return []int{i + 1}
+}
+
+func (verifier *verifier) targets(instruction instructions.Instruction) []int {
+	var targets []int
+	for _, param := range instruction.Params {
+		if target, ok := param.(int); ok && target >= 0 && target <= len(verifier.instructions) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// label returns the index of the label a call or goto refers to.
+func (verifier *verifier) label(instruction instructions.Instruction) (int, bool) {
+	name, _ := instruction.Params[0].(string)
+	target, ok := verifier.labels[name]
+	if !ok || target < 0 || target > len(verifier.instructions) {
+		return 0, false
+	}
+	return target, true
+}
+
+// callTarget returns the procedure called by the instruction at i, if it calls one.
+func (verifier *verifier) callTarget(i int) (int, bool) {
+	if verifier.instructions[i].OpCode != instructions.INS_CALL {
+		return 0, false
+	}
+	return verifier.label(verifier.instructions[i])
+}
+
+// isReturn reports whether the instruction at i returns from a procedure.
+func (verifier *verifier) isReturn(i int) bool {
+	instruction := verifier.instructions[i]
+	if instruction.OpCode == instructions.INS_RET {
+		return true
+	}
+
+	if instruction.OpCode != instructions.INS_GOTO {
+		return false
+	}
+
+	name, _ := instruction.Params[0].(string)
+	return name == "$"
+}
+
+func (verifier *verifier) location(index int) string {
+	if index >= 0 && index < len(verifier.instructions) && verifier.instructions[index].Line > 0 {
+		return fmt.Sprintf("line %v", verifier.instructions[index].Line)
+	}
+	return fmt.Sprintf("instruction %v", index)
+}
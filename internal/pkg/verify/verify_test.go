@@ -0,0 +1,241 @@
+package verify_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+	"mvmo.dev/sickvm/internal/pkg/verify"
+)
+
+func check(t *testing.T, source string, options ...verify.Option) []verify.Diagnostic {
+	t.Helper()
+
+	instructionList, labels, err := parser.NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return verify.Verify(instructionList, labels, options...)
+}
+
+func TestDiagnostics(t *testing.T) {
+	testCases := []struct {
+		source   string
+		severity verify.Severity
+		line     int
+		message  string
+	}{
+		{"call missing", verify.Error, 1, "undefined label missing"},
+		{"goto missing", verify.Error, 1, "undefined label missing"},
+		{"a:\nipush 1\na:\nprintln", verify.Error, 3, "label a is already defined at line 1"},
+		{"jmp end\nipush 1\nprintln\nend:", verify.Warning, 2, "unreachable code"},
+		{"load x\nprintln", verify.Warning, 1, "x is loaded but never stored"},
+		{"add", verify.Error, 1, "stack underflow: add needs 2 objects, have 0"},
+		{"bpush true\ncjmp one two\none:\nipush 1\ntwo:\nprintln", verify.Error, 5, "stack depth mismatch: 1 coming from line 4, 0 on another path"},
+		{"ipush 1\nloop:\nipush 1\njmp loop", verify.Error, 2, "stack depth mismatch: 2 coming from line 4, 1 on another path"},
+		{"call proc\nprintln\njmp end\nproc:\nbpush true\ncjmp a b\na:\nipush 1\nret\nb:\nret\nend:", verify.Error, 9, "procedure changes the stack depth by 1 here and by 0 on another path"},
+	}
+
+	for _, testCase := range testCases {
+		diagnostics := check(t, testCase.source)
+
+		found := false
+		for _, diagnostic := range diagnostics {
+			if diagnostic.Severity == testCase.severity && diagnostic.Line == testCase.line && diagnostic.Message == testCase.message {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: expected %v at line %v: %q and got %v", testCase.source, testCase.severity, testCase.line, testCase.message, diagnostics)
+		}
+	}
+}
+
+func TestOutOfRangeJump(t *testing.T) {
+	instructionList := []instructions.Instruction{
+		{OpCode: instructions.INS_JMP, Params: []interface{}{99}},
+	}
+
+	diagnostics := verify.Verify(instructionList, nil)
+	if len(diagnostics) != 1 || diagnostics[0].Message != "jmp target 99 is out of range 0..1" || !verify.HasErrors(diagnostics) {
+		t.Errorf("expected out of range jump and got %v", diagnostics)
+	}
+}
+
+func TestMalformedInstructions(t *testing.T) {
+	instructionList := []instructions.Instruction{
+		{OpCode: instructions.INS_CALL},
+		{OpCode: instructions.INS_JMP, Params: []interface{}{"end"}},
+	}
+
+	diagnostics := verify.Verify(instructionList, nil)
+	if len(diagnostics) != 2 || diagnostics[0].Message != "call requires 1 parameters and got 0" || !verify.HasErrors(diagnostics) {
+		t.Errorf("expected malformed instructions to be reported and got %v", diagnostics)
+	}
+}
+
+func TestValidPrograms(t *testing.T) {
+	testCases := []string{
+		// recursion needs the summary of the procedure being analysed
+		"ipush 10\ncall count\nprintln\njmp end\ncount:\nlocal n\nload n\nipush 0\ncmp\ncjmp zero more\nzero:\nipush 0\nret\nmore:\nload n\nipush 1\nsub\ncall count\nipush 1\nadd\nret\nend:",
+		// the handler starts with the exception on the stack
+		"try handler\nspush \"boom\"\nthrow\nhandler:\nprintln",
+		"goto proc\nproc:\nipush 1\nprintln",
+	}
+
+	for _, source := range testCases {
+		if diagnostics := check(t, source); len(diagnostics) > 0 {
+			t.Errorf("%q: expected no diagnostics and got %v", source, diagnostics)
+		}
+	}
+}
+
+func TestNatives(t *testing.T) {
+	source := "ipush 1\ncall double\nnative \"triple\"\nprintln"
+
+	diagnostics := check(t, source, verify.WithNatives("double"))
+	if len(diagnostics) != 1 || diagnostics[0].Message != `undefined native "triple"` {
+		t.Errorf("expected undefined native and got %v", diagnostics)
+	}
+
+	// results of natives aren't known, so nothing is reported after them
+	if diagnostics := check(t, source, verify.WithNatives("double", "triple")); len(diagnostics) > 0 {
+		t.Errorf("expected no diagnostics and got %v", diagnostics)
+	}
+}
+
+func TestExamples(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "..", "examples", "*.sickc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, diagnostic := range check(t, string(content)) {
+			if diagnostic.Severity == verify.Error {
+				t.Errorf("%v: %v", filepath.Base(file), diagnostic)
+			}
+		}
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	diagnostics := check(t, "ipush 1\nadd")
+	if len(diagnostics) != 1 || !strings.HasPrefix(diagnostics[0].String(), "line 2: error: stack underflow") {
+		t.Errorf("unexpected diagnostics %v", diagnostics)
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	testCases := []struct {
+		source  string
+		line    int
+		message string
+	}{
+		{"spush \"a\"\nipush 2\nmul", 3, "can't do sick::string * sick::int"},
+		{"ipush 1\nbpush true\nadd", 3, "can't do sick::int + sick::bool"},
+		{"ipush 1\nipush 2\nadd\nreq sick::string", 4, "required type sick::string and got sick::int"},
+		{"fpush 1.5\nipush 2\nadd\nalen", 4, "alen requires sick::array and got sick::float"},
+		{"spush \"a\"\nipush 1\nsub\nipush 1\ncmp\nipush 2\nadd", 7, "can't do sick::bool + sick::int"},
+		{"ipush 1\ncjmp a a\na:", 2, "cjmp requires sick::bool and got sick::int"},
+		// types flow through dup, swap and procedures
+		{"ipush 1\nspush \"a\"\nswap\ndup\nmul\nlt", 6, "lt requires sick::int|sick::float and got sick::string"},
+		{"call two\nreq sick::bool\njmp end\ntwo:\nipush 2\nret\nend:", 2, "required type sick::bool and got sick::int"},
+		// the type of a value depends on the path taken
+		{"bpush true\ncjmp a b\na:\nipush 1\njmp c\nb:\nfpush 1.5\nc:\nalen", 9, "alen requires sick::array and got sick::int|sick::float"},
+	}
+
+	for _, testCase := range testCases {
+		diagnostics := check(t, testCase.source, verify.WithTypes())
+
+		found := false
+		for _, diagnostic := range diagnostics {
+			if diagnostic.Severity == verify.Error && diagnostic.Line == testCase.line && diagnostic.Message == testCase.message {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: expected error at line %v: %q and got %v", testCase.source, testCase.line, testCase.message, diagnostics)
+		}
+	}
+}
+
+func TestWellTyped(t *testing.T) {
+	testCases := []string{
+		// add works on strings with any scalar, in both orders
+		"spush \"n = \"\nipush 1\nadd\nbpush true\nadd\nfpush 1.5\nswap\nadd\nprintln",
+		"ipush 1\nfpush 2.5\nadd\nipush 2\nmul\nipush 1\nlt\nprintln",
+		// req narrows down values of unknown type
+		"ipush 1\nstore x\nload x\nreq sick::int\nipush 1\nadd\nprintln",
+		"anew\nipush 1\napush\nipush 0\naget\nprintln",
+		"mnew\nspush \"k\"\nipush 1\nmput\nspush \"k\"\nmhas\nprintln",
+		"readint\nreadln\nsizeof\nadd\nprintln",
+		"try handler\nspush \"boom\"\nthrow\nhandler:\nprintln",
+		// only instructions failing on every path are reported
+		"bpush true\ncjmp a b\na:\nipush 1\njmp c\nb:\nmnew\nc:\nmlen\nprintln",
+	}
+
+	for _, source := range testCases {
+		if diagnostics := check(t, source, verify.WithTypes()); len(diagnostics) > 0 {
+			t.Errorf("%q: expected no diagnostics and got %v", source, diagnostics)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "..", "examples", "*.sickc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, diagnostic := range check(t, string(content), verify.WithTypes()) {
+			if diagnostic.Severity == verify.Error {
+				t.Errorf("%v: %v", filepath.Base(file), diagnostic)
+			}
+		}
+	}
+}
+
+func TestStackDepths(t *testing.T) {
+	testCases := []struct {
+		source   string
+		expected string
+	}{
+		{"ipush 1\nipush 2\nadd\nprintln", "[0 1 2 1]"},
+		// different depths meet at b, nothing after the jmp is reached
+		{"readint\ncjmp a b\na:\nipush 1\nb:\nprintln\njmp c\nipush 1\nc:", "[0 1 0 0 -1 -1 -1 -1 -1]"},
+		// procedures count from their own start, including the objects they take
+		{"ipush 1\ncall p\njmp end\np:\ndrop\nipush 2\nret\nend:", "[0 1 1 0 0 0 0 1]"},
+		{"try h\nipush 1\nthrow\nh:\nprintln", "[0 0 1 1 1]"},
+	}
+
+	for _, testCase := range testCases {
+		instructionList, labels, err := parser.NewParser().Parse(testCase.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if depths := fmt.Sprint(verify.StackDepths(instructionList, labels)); depths != testCase.expected {
+			t.Errorf("%q: expected depths %v and got %v", testCase.source, testCase.expected, depths)
+		}
+	}
+
+	malformed := []instructions.Instruction{{OpCode: instructions.INS_IPUSH, Params: []interface{}{1}}, {OpCode: instructions.INS_CALL}}
+	if depths := fmt.Sprint(verify.StackDepths(malformed, nil)); depths != "[-1 -1]" {
+		t.Errorf("expected no depths for a malformed program and got %v", depths)
+	}
+}
@@ -0,0 +1,287 @@
+// Package vm embeds the sick virtual machine into Go programs.
+//
+// A program is compiled once and can then be run by any number of VMs:
+//
+//	program, err := vm.Compile(`ipush 20 ...`)
+//	machine := vm.New(program, vm.WithGasLimit(10000))
+//	err = machine.Run()
+//	result, ok := machine.Result()
+package vm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"mvmo.dev/sickvm/internal/pkg/bytecode"
+	"mvmo.dev/sickvm/internal/pkg/instructions"
+	"mvmo.dev/sickvm/internal/pkg/interpreter"
+	"mvmo.dev/sickvm/internal/pkg/parser"
+	"mvmo.dev/sickvm/internal/pkg/types"
+)
+
+// The values programs work with.
+type (
+	Object = types.SickObject
+	String = types.SickString
+	Int    = types.SickInt
+	Float  = types.SickFloat
+	Bool   = types.SickBool
+	Array  = types.SickArray
+	Map    = types.SickMap
+)
+
+// Errors returned while compiling and running programs.
+type (
+	ParseError   = parser.ParseError
+	ParseErrors  = parser.ParseErrors
+	RuntimeError = interpreter.RuntimeError
+	Exception    = interpreter.Exception
+)
+
+var (
+	ErrStackUnderflow    = interpreter.ErrStackUnderflow
+	ErrStackOverflow     = interpreter.ErrStackOverflow
+	ErrCallStackOverflow = interpreter.ErrCallStackOverflow
+	ErrOutOfGas          = interpreter.ErrOutOfGas
+	ErrEndOfInput        = interpreter.ErrEndOfInput
+)
+
+// Program is a compiled program. It isn't modified by running it, so it can
+// be shared between VMs.
+type Program struct {
+	instructions []instructions.Instruction
+	labels       map[string]int
+}
+
+// Compile parses .sickc source into a Program.
+func Compile(source string) (*Program, error) {
+	return compile("", source)
+}
+
+// CompileFile reads a program from a .sickc source or a bytecode file.
+func CompileFile(path string) (*Program, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytecode.IsBytecode(content) {
+		return LoadBytecode(bytes.NewReader(content))
+	}
+	return compile(path, string(content))
+}
+
+func compile(file string, source string) (*Program, error) {
+	instructionList, labels, err := parser.NewParser().ParseFile(file, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{instructionList, *labels}, nil
+}
+
+// LoadBytecode reads a program that was written by WriteBytecode or sick build.
+func LoadBytecode(r io.Reader) (*Program, error) {
+	instructionList, labels, err := bytecode.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{instructionList, *labels}, nil
+}
+
+// WriteBytecode writes the program in the binary bytecode format.
+func (program *Program) WriteBytecode(w io.Writer) error {
+	return bytecode.Encode(w, program.instructions, &program.labels)
+}
+
+// Option configures a VM.
+type Option = interpreter.Option
+
+// WithStdout sets where print and println write to, os.Stdout by default.
+func WithStdout(w io.Writer) Option {
+	return interpreter.WithStdout(w)
+}
+
+// WithStderr sets where diagnostics like the output of dump are written to, os.Stderr by default.
+func WithStderr(w io.Writer) Option {
+	return interpreter.WithStderr(w)
+}
+
+// WithStdin sets where input instructions read from, os.Stdin by default.
+func WithStdin(r io.Reader) Option {
+	return interpreter.WithStdin(r)
+}
+
+// WithGasLimit stops the program with ErrOutOfGas once it would use more than limit gas.
+func WithGasLimit(limit int) Option {
+	return interpreter.WithGasLimit(limit)
+}
+
+// WithGasCosts sets the gas cost of instructions by mnemonic, all others cost 1.
+// It panics on an unknown mnemonic or a negative cost.
+func WithGasCosts(costs map[string]int) Option {
+	opCosts := make(map[int]int, len(costs))
+	for mnemonic, cost := range costs {
+		opCode, ok := instructions.Lookup(mnemonic)
+		if !ok {
+			panic(fmt.Sprintf("vm: gas cost for unknown instruction %v", mnemonic))
+		}
+		opCosts[opCode] = cost
+	}
+	return interpreter.WithGasCosts(opCosts)
+}
+
+// WithMaxStackDepth limits the amount of objects on the stack, 0 means no limit.
+func WithMaxStackDepth(depth int) Option {
+	return interpreter.WithMaxStackDepth(depth)
+}
+
+// WithMaxCallDepth limits how many calls can be pending at once.
+func WithMaxCallDepth(depth int) Option {
+	return interpreter.WithMaxCallDepth(depth)
+}
+
+// VM runs a single execution of a Program. It must not be used concurrently.
+type VM struct {
+	program     *Program
+	interpreter *interpreter.Interpreter
+}
+
+// New creates a VM that starts at the first instruction of program.
+func New(program *Program, options ...Option) *VM {
+	labels := make(map[string]int, len(program.labels))
+	for name, index := range program.labels {
+		labels[name] = index
+	}
+
+	return &VM{
+		program:     program,
+		interpreter: interpreter.NewInterpreter(program.instructions, &labels, options...),
+	}
+}
+
+// Run executes the program until it ends or fails.
+func (vm *VM) Run() error {
+	return vm.interpreter.Run()
+}
+
+// RunContext is like Run, but stops once ctx is done.
+func (vm *VM) RunContext(ctx context.Context) error {
+	return vm.interpreter.RunContext(ctx)
+}
+
+// Step executes a single instruction.
+func (vm *VM) Step() error {
+	return vm.interpreter.Step()
+}
+
+// RunFor executes at most n instructions.
+func (vm *VM) RunFor(n int) error {
+	return vm.interpreter.RunFor(n)
+}
+
+// Halted reports whether the program ended.
+func (vm *VM) Halted() bool {
+	return vm.interpreter.Halted()
+}
+
+// GasUsed returns the gas consumed so far.
+func (vm *VM) GasUsed() int {
+	return vm.interpreter.GasUsed()
+}
+
+// Stack returns a copy of the stack, the head being the last element.
+func (vm *VM) Stack() []Object {
+	return vm.interpreter.Stack()
+}
+
+// Result returns the head of the stack, which is where programs leave their result.
+func (vm *VM) Result() (Object, bool) {
+	stack := vm.interpreter.Stack()
+	if len(stack) == 0 {
+		return nil, false
+	}
+	return stack[len(stack)-1], true
+}
+
+// Push puts value onto the stack, e.g. to pass arguments before running.
+func (vm *VM) Push(value Object) {
+	vm.interpreter.Push(value)
+}
+
+// Load returns a global variable of the program.
+func (vm *VM) Load(identifier string) (Object, bool) {
+	value, ok := vm.interpreter.Storage()[identifier]
+	return value, ok
+}
+
+// Store sets a global variable of the program.
+func (vm *VM) Store(identifier string, value Object) {
+	vm.interpreter.Store(identifier, value)
+}
+
+// HostFunc is a Go function that programs invoke with native "name" or with
+// call name if the program has no label with that name. args holds the
+// arguments in the order they were pushed, the results are pushed in order.
+type HostFunc func(vm *VM, args []Object) ([]Object, error)
+
+// Register makes fn callable by the program under name. It takes exactly
+// arity arguments from the stack, failing with ErrStackUnderflow if there are
+// fewer. An error returned by fn stops the program with a RuntimeError.
+func (vm *VM) Register(name string, arity int, fn HostFunc) {
+	vm.interpreter.RegisterNative(name, arity, func(_ *interpreter.Interpreter, args []types.SickObject) ([]types.SickObject, error) {
+		return fn(vm, args)
+	})
+}
+
+// ValueOf converts a Go value into an Object. Supported are the Object types
+// themselves, int, float64, string, bool and slices and maps of those. Map
+// entries are inserted in the order of their keys.
+func ValueOf(value interface{}) (Object, error) {
+	switch value := value.(type) {
+	case Object:
+		return value, nil
+	case int:
+		return Int{Value: value}, nil
+	case float64:
+		return Float{Value: value}, nil
+	case string:
+		return String{Value: value}, nil
+	case bool:
+		return Bool{Value: value}, nil
+	case []interface{}:
+		array := types.NewSickArray()
+		for _, element := range value {
+			object, err := ValueOf(element)
+			if err != nil {
+				return nil, err
+			}
+			array.Append(object)
+		}
+		return array, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		sickMap := types.NewSickMap()
+		for _, key := range keys {
+			object, err := ValueOf(value[key])
+			if err != nil {
+				return nil, err
+			}
+			if err := sickMap.Put(String{Value: key}, object); err != nil {
+				return nil, err
+			}
+		}
+		return sickMap, nil
+	}
+	return nil, fmt.Errorf("vm: can't convert %T to an Object", value)
+}
@@ -0,0 +1,209 @@
+package vm_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvmo.dev/sickvm/vm"
+)
+
+const fib = `call fib
+jmp end
+fib:
+local n
+load n
+ipush 2
+lt
+cjmp base recurse
+base:
+load n
+ret
+recurse:
+load n
+ipush 1
+sub
+call fib
+load n
+ipush 2
+sub
+call fib
+add
+ret
+end:`
+
+func TestRunProgram(t *testing.T) {
+	program, err := vm.Compile(fib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n, expected := range []int{0, 1, 1, 2, 3, 5, 8, 13} {
+		machine := vm.New(program)
+		machine.Push(vm.Int{Value: n})
+		if err := machine.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		result, ok := machine.Result()
+		if !ok || result != (vm.Int{Value: expected}) {
+			t.Errorf("fib(%v): expected %v and got %v", n, expected, result)
+		}
+	}
+}
+
+func TestBytecode(t *testing.T) {
+	program, err := vm.Compile("load name\nspush \"Hello, \"\nswap\nadd\nprintln")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encoded bytes.Buffer
+	if err := program.WriteBytecode(&encoded); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := vm.LoadBytecode(&encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	machine := vm.New(loaded, vm.WithStdout(&output))
+	machine.Store("name", vm.String{Value: "sick"})
+	if err := machine.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.String() != "Hello, sick\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, err := vm.Compile("ipush one")
+	var parseErrors vm.ParseErrors
+	if !errors.As(err, &parseErrors) || parseErrors[0].Line != 1 {
+		t.Errorf("expected ParseErrors and got %v", err)
+	}
+
+	program, err := vm.Compile("loop:\njmp loop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := vm.New(program, vm.WithGasLimit(100), vm.WithGasCosts(map[string]int{"jmp": 5}))
+	err = machine.Run()
+
+	var runtimeErr *vm.RuntimeError
+	if !errors.As(err, &runtimeErr) || !errors.Is(err, vm.ErrOutOfGas) {
+		t.Errorf("expected a RuntimeError caused by ErrOutOfGas and got %v", err)
+	}
+	if machine.GasUsed() != 97 {
+		t.Errorf("expected 97 gas to be used and got %v", machine.GasUsed())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a gas cost for an unknown instruction to panic")
+		}
+	}()
+	vm.WithGasCosts(map[string]int{"jump": 5})
+}
+
+func TestValueOf(t *testing.T) {
+	value, err := vm.ValueOf(map[string]interface{}{
+		"b": []interface{}{1, 2.5, true},
+		"a": "text",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if human := value.ToHuman(); human != `{"a": "text", "b": [1, 2.5, true]}` {
+		t.Errorf("unexpected value %v", human)
+	}
+
+	if _, err := vm.ValueOf(struct{}{}); err == nil {
+		t.Errorf("expected an error for unsupported values")
+	}
+}
+
+func Example() {
+	program, err := vm.Compile(`
+spush "Hello, "
+load name
+add
+println
+`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var output strings.Builder
+	machine := vm.New(program, vm.WithStdout(&output))
+	machine.Store("name", vm.String{Value: "World!"})
+	if err := machine.Run(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Print(output.String())
+	// Output: Hello, World!
+}
+
+func TestHostFunctions(t *testing.T) {
+	program, err := vm.Compile(`spush "a,b,c"
+spush ","
+native "split"
+alen
+call double
+store count
+ipush 1
+native "fail"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := vm.New(program)
+	machine.Register("split", 2, func(machine *vm.VM, args []vm.Object) ([]vm.Object, error) {
+		array := &vm.Array{}
+		for _, part := range strings.Split(args[0].ToHuman(), args[1].ToHuman()) {
+			array.Append(vm.String{Value: part})
+		}
+		return []vm.Object{array}, nil
+	})
+	machine.Register("double", 1, func(machine *vm.VM, args []vm.Object) ([]vm.Object, error) {
+		return []vm.Object{args[0], args[0]}, nil
+	})
+	machine.Register("fail", 1, func(machine *vm.VM, args []vm.Object) ([]vm.Object, error) {
+		return nil, errors.New("failed on purpose")
+	})
+
+	err = machine.Run()
+	if err == nil || !strings.Contains(err.Error(), "failed on purpose") {
+		t.Errorf("expected the error of fail and got %v", err)
+	}
+
+	if count, _ := machine.Load("count"); count != (vm.Int{Value: 3}) {
+		t.Errorf("expected count to be 3 and got %v", count)
+	}
+	if stack := machine.Stack(); len(stack) != 2 || stack[1] != (vm.Int{Value: 1}) {
+		t.Errorf("expected the arguments of fail to stay on the stack, got %v", stack)
+	}
+
+	program, err = vm.Compile("native \"split\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine = vm.New(program)
+	machine.Register("split", 2, func(machine *vm.VM, args []vm.Object) ([]vm.Object, error) {
+		return nil, nil
+	})
+	if err := machine.Run(); !errors.Is(err, vm.ErrStackUnderflow) {
+		t.Errorf("expected a stack underflow and got %v", err)
+	}
+}